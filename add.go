@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// readJsonInput reads from the file named in args, or stdin if there isn't one (or it's "-")
+func (self *LPass) readJsonInput(args []string) ([]byte, error) {
+	if len(args) > 0 && args[0] != "-" {
+		return ioutil.ReadFile(args[0])
+	}
+
+	return ioutil.ReadAll(self.stdin())
+}
+
+func ParseSecureNoteJson(data []byte) (*LPassSecureNote, error) {
+	note := &LPassSecureNote{}
+	err := json.Unmarshal(data, note)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secure note json: %s", err)
+	}
+
+	if note.EntryInfo == nil {
+		note.EntryInfo = &LPassEntry{}
+	}
+
+	if note.Credential == nil {
+		note.Credential = &StandardCredential{}
+	}
+
+	if note.Properties == nil {
+		note.Properties = make(map[string]string)
+	}
+
+	note.Typed = nil
+	if nt := note.NoteType(); nt != nil {
+		note.Typed = nt.FromProperties(note.Properties)
+	}
+
+	return note, nil
+}
+
+// GetStandardCredential decodes the Notes as a StandardCredential, any key
+// that isn't a StandardCredential field is an error.  Keys starting with
+// an '_' are comments (see `rlpass spec`) and are ignored.
+func (self *LPassSecureNote) GetStandardCredential() (*StandardCredential, error) {
+	cred := &StandardCredential{}
+	if self.Notes == nil {
+		return cred, nil
+	}
+
+	data, err := json.Marshal(self.Notes)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("expected Notes to be a json object: %s", err)
+	}
+
+	for k := range fields {
+		if strings.HasPrefix(k, "_") {
+			delete(fields, k)
+		}
+	}
+
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(cred)
+	if err != nil {
+		return nil, fmt.Errorf("Notes is not a StandardCredential: %s", err)
+	}
+
+	return cred, nil
+}
+
+// EntryName is the lastpass name (including the folder) for the note
+func (self *LPassSecureNote) EntryName(cred *StandardCredential) string {
+	name := ""
+	if self.EntryInfo != nil {
+		name = self.EntryInfo.AccountNameIncludingPath
+	}
+
+	if name == "" {
+		name = cred.Name
+	}
+
+	return strings.TrimPrefix(name, "(none)/")
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, val := range vals {
+		if val != "" {
+			return val
+		}
+	}
+
+	return ""
+}
+
+// ToLPassInput renders the note in the format `lpass add --non-interactive` reads on stdin
+func (self *LPassSecureNote) ToLPassInput(cred *StandardCredential) (string, error) {
+	lines := make([]string, 0)
+	fields := []struct{ Name, Value string }{
+		{"Username", firstNonEmpty(self.Credential.Username, self.Properties["Username"], cred.Username)},
+		{"Password", firstNonEmpty(self.Credential.Password, self.Properties["Password"], cred.Password)},
+		{"URL", firstNonEmpty(self.Credential.Url, self.Properties["URL"], cred.Url)},
+	}
+
+	for _, field := range fields {
+		if field.Value != "" {
+			lines = append(lines, field.Name+": "+field.Value)
+		}
+	}
+
+	props := make(map[string]string)
+	for k, v := range self.Properties {
+		props[k] = v
+	}
+
+	// NB: a typed note's empty properties are filled from the
+	// StandardCredential, eg: an SSH key's Passphrase from the Password
+	if nt := self.NoteType(); nt != nil {
+		merged := *cred
+		merged.Username, merged.Password, merged.Url = fields[0].Value, fields[1].Value, fields[2].Value
+		for k, v := range nt.ToProperties(nt.FromStandardCredential(&merged)) {
+			if props[k] == "" {
+				props[k] = v
+			}
+		}
+	}
+
+	keys := make([]string, 0)
+	for k := range props {
+		// NB: the NoteType is passed to lpass as --note-type, see LPassType
+		if strings.HasPrefix(k, "_") || k == "Username" || k == "Password" || k == "URL" || k == "Notes" || k == "NoteType" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		lines = append(lines, k+": "+props[k])
+	}
+
+	notes, err := json.MarshalIndent(self.Notes, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	lines = append(lines, "Notes:", string(notes))
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+func (self *LPass) Add(args []string) (*exec.Cmd, error) {
+	data, err := self.readJsonInput(args)
+	if err != nil {
+		return nil, err
+	}
+
+	note, err := ParseSecureNoteJson(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ValidateSecureNote(note)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := note.GetStandardCredential()
+	if err != nil {
+		return nil, err
+	}
+
+	name := note.EntryName(cred)
+	input, err := note.ToLPassInput(cred)
+	if err != nil {
+		return nil, err
+	}
+
+	var id string
+	err = self.withLogin(func() (err error) {
+		id, err = self.backend().Add(name, note.LPassType(), input)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = self.cacheInvalidate(listCacheKey)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("%s\n", id)
+
+	return nil, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const addNoteJson = `{
+  "EntryInfo": {"AccountNameIncludingPath": "Shared-Infra/db/reporting"},
+  "Credential": {"Username": "reporting", "Password": "s3cr3t", "Url": "postgres://db.some.where/reporting"},
+  "Properties": {"_properties": "ignored", "Port": "5432"},
+  "Notes": {"Name": "reporting", "Owner": "platform", "Description": "read only reporting user"}
+}`
+
+func TestAddFromStdin(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	lpass.Stdin = strings.NewReader(addNoteJson)
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Add([]string{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := strings.TrimSpace(output)
+	ent := fake.Find(id)
+	if ent == nil {
+		t.Fatalf("Error: expected add to print the new id, got '%s'", output)
+	}
+
+	if ent.Path != "Shared-Infra/db/reporting" {
+		t.Errorf("Error: expected the entry to be named Shared-Infra/db/reporting, got '%s'", ent.Path)
+	}
+
+	if ent.Get("Username") != "reporting" || ent.Get("Password") != "s3cr3t" || ent.Get("Port") != "5432" {
+		t.Errorf("Error: fields were not added, got %s", ent.ToShowOutput())
+	}
+
+	if ent.Get("_properties") != "" {
+		t.Errorf("Error: expected _ prefixed properties to be ignored, got %s", ent.ToShowOutput())
+	}
+
+	var notes map[string]string
+	err = json.Unmarshal([]byte(ent.Get("Notes")), &notes)
+	if err != nil || notes["Owner"] != "platform" {
+		t.Errorf("Error: expected the Notes to be json, got '%s' / %v", ent.Get("Notes"), err)
+	}
+}
+
+func TestAddFromFileInvalidatesListCache(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	_, err := lpass.GetList([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fname := filepath.Join(t.TempDir(), "note.json")
+	err = ioutil.WriteFile(fname, []byte(addNoteJson), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	captureStdout(t, func() {
+		_, err = lpass.Add([]string{fname})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := lpass.GetList([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 4 {
+		t.Errorf("Error: expected 4 entries after add, got %d", len(entries))
+	}
+}
+
+func TestAddUnixTimestamp(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	lpass.Stdin = strings.NewReader(`{"Notes": {"Name": "x", "Owner": "o", "ExpiresAt": 1700000000}}`)
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Add([]string{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ent := fake.Find(strings.TrimSpace(output))
+	if ent == nil || !strings.Contains(ent.Get("Notes"), `"ExpiresAt": 1700000000`) {
+		t.Errorf("Error: expected the note to be added with its ExpiresAt, got '%s'", output)
+	}
+}
+
+func TestAddRejectsInvalidNotes(t *testing.T) {
+	cases := map[string]string{
+		"unknown field": `{"Notes": {"Name": "x", "Colour": "blue"}}`,
+		"missing name":  `{"Notes": {"Owner": "platform"}}`,
+		"not json":      `{"Notes": `,
+	}
+
+	for label, input := range cases {
+		lpass, fake := newFakeLPass(t, "basic")
+		lpass.Stdin = strings.NewReader(input)
+
+		_, err := lpass.Add([]string{})
+		if err == nil {
+			t.Errorf("Error: expected add to reject %s", label)
+		}
+
+		if len(fake.Mutations) != 0 {
+			t.Errorf("Error: expected no mutations for %s, got %+v", label, fake.Mutations)
+		}
+	}
+}
+
+func TestSpecIsValidAddInput(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	output := captureStdout(t, func() {
+		lpass.Spec([]string{}, SpecOptions{})
+	})
+
+	note, err := ParseSecureNoteJson([]byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = note.GetStandardCredential()
+	if err != nil {
+		t.Errorf("Error: expected the spec template's Notes to be a StandardCredential: %s", err)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Backend is the set of operations rlpass needs from a LastPass vault.
+// Responses are in the same text format the lpass cli emits, so the
+// parsers (ParseLPassList, ParseShow) work the same against any Backend.
+// Backends report an expired session as ErrNotLoggedIn and unknown
+// entries as ErrEntryNotFound.
+type Backend interface {
+	// List returns the output of `lpass ls --format=<format>`
+	List(format string) (string, error)
+	// Show returns the output of `lpass show --color=never --all <id_or_name>`
+	Show(id_or_name string) (string, error)
+	// Add creates a new entry from the `lpass add --non-interactive` input
+	// format, returning the new entry's id
+	Add(name string, noteType string, data string) (string, error)
+	// Edit sets a single field (eg: Username, Password, URL, Notes or any
+	// custom field name) on an existing entry
+	Edit(id_or_name string, field string, value string) error
+	Remove(id_or_name string) error
+	Sync() error
+	Status() (string, error)
+}
+
+// LoginBackend is implemented by Backends that can (re)establish a session.
+type LoginBackend interface {
+	Login(username string) error
+}
+
+func (self *LPass) backend() Backend {
+	if self.Backend == nil {
+		self.Backend = NewLPassCli()
+	}
+
+	return self.Backend
+}
+
+// LPassCli is the Backend that shells out to the lpass binary.
+type LPassCli struct {
+}
+
+func NewLPassCli() *LPassCli {
+	return &LPassCli{}
+}
+
+func (self *LPassCli) Exec(args []string) (*exec.Cmd, error) {
+	// TODO: cache or otherwise remember this lookup?
+	binaryPath, err := exec.LookPath("lpass")
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBinaryNotFound, err)
+	}
+
+	log.Println(fmt.Sprintf("LPass.Exec: found lpass binary at %s\n", binaryPath))
+	log.Println(fmt.Sprintf("LPass.Exec: executing lpass with args=%q\n", args))
+
+	childProcess := exec.Command(binaryPath, args...)
+	return childProcess, nil
+}
+
+func (self *LPassCli) run(args []string, stdin string) (string, error) {
+	childProc, err := self.Exec(args)
+	if err != nil {
+		return "", err
+	}
+
+	if stdin != "" {
+		childProc.Stdin = strings.NewReader(stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+	childProc.Stdout = &stdout
+	childProc.Stderr = &stderr
+
+	err = childProc.Run()
+	if err != nil {
+		return stdout.String(), NewLPassError(args, err, stdout.String(), stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+// Login runs `lpass login` as a child process attached to the terminal so
+// rlpass can carry on afterwards, unlike LPass.Login which execs lpass
+func (self *LPassCli) Login(username string) error {
+	childProc, err := self.Exec([]string{"login", "--trust", username})
+	if err != nil {
+		return err
+	}
+
+	childProc.Stdin = os.Stdin
+	childProc.Stdout = os.Stderr
+	childProc.Stderr = os.Stderr
+
+	err = childProc.Run()
+	if err != nil {
+		return NewLPassError([]string{"login"}, err, "", "")
+	}
+
+	return nil
+}
+
+func (self *LPassCli) List(format string) (string, error) {
+	return self.run([]string{"ls", "--format=" + format}, "")
+}
+
+func (self *LPassCli) Show(id_or_name string) (string, error) {
+	return self.run([]string{"show", "--color=never", "--all", id_or_name}, "")
+}
+
+func (self *LPassCli) Add(name string, noteType string, data string) (string, error) {
+	args := []string{"add", "--non-interactive", "--sync=now"}
+	if noteType != "" {
+		args = append(args, "--note-type="+noteType)
+	}
+
+	// NB: lpass add doesn't print the new id and the name needn't be
+	// unique, so the new id is the one that wasn't there before
+	before, err := self.List("%ai")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = self.run(append(args, name), data)
+	if err != nil {
+		return "", err
+	}
+
+	after, err := self.List("%ai")
+	if err != nil {
+		return "", err
+	}
+
+	known := make(map[string]bool)
+	for _, id := range strings.Fields(before) {
+		known[id] = true
+	}
+
+	added := make([]string, 0)
+	for _, id := range strings.Fields(after) {
+		if !known[id] {
+			added = append(added, id)
+		}
+	}
+
+	if len(added) != 1 {
+		return "", fmt.Errorf("lpass add %s: expected 1 new entry, found %d %q", name, len(added), added)
+	}
+
+	return added[0], nil
+}
+
+// NB: lpass edit has dedicated flags for the built in fields, everything else is a --field
+func lpassEditFlag(field string) string {
+	switch field {
+	case "Name":
+		return "--name"
+	case "Username":
+		return "--username"
+	case "Password":
+		return "--password"
+	case "URL":
+		return "--url"
+	case "Notes":
+		return "--notes"
+	}
+
+	return "--field=" + field
+}
+
+func (self *LPassCli) Edit(id_or_name string, field string, value string) error {
+	_, err := self.run([]string{"edit", "--non-interactive", "--sync=now", lpassEditFlag(field), id_or_name}, value)
+	return err
+}
+
+func (self *LPassCli) Remove(id_or_name string) error {
+	_, err := self.run([]string{"rm", "--sync=now", id_or_name}, "")
+	return err
+}
+
+func (self *LPassCli) Sync() error {
+	_, err := self.run([]string{"sync"}, "")
+	return err
+}
+
+func (self *LPassCli) Status() (string, error) {
+	output, err := self.run([]string{"status", "--color=never"}, "")
+	return strings.TrimSpace(output), err
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CertificateInfo is what rlpass shows of an X.509 certificate found in
+// one of a note's properties, Index is its position in a chain
+type CertificateInfo struct {
+	Property    string
+	Index       int
+	Subject     string
+	Issuer      string
+	SANs        []string `json:",omitempty"`
+	Serial      string
+	NotBefore   Timestamp
+	NotAfter    Timestamp
+	Fingerprint string
+	cert        *x509.Certificate
+}
+
+// colonHex formats bytes the way openssl prints fingerprints, eg: AB:CD:01
+func colonHex(b []byte) string {
+	parts := make([]string, len(b))
+	for idx, c := range b {
+		parts[idx] = fmt.Sprintf("%02X", c)
+	}
+	return strings.Join(parts, ":")
+}
+
+func NewCertificateInfo(property string, index int, cert *x509.Certificate) *CertificateInfo {
+	sans := make([]string, 0)
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	return &CertificateInfo{
+		Property:    property,
+		Index:       index,
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		SANs:        sans,
+		Serial:      colonHex(cert.SerialNumber.Bytes()),
+		NotBefore:   Timestamp(cert.NotBefore.UTC().Format(time.RFC3339)),
+		NotAfter:    Timestamp(cert.NotAfter.UTC().Format(time.RFC3339)),
+		Fingerprint: colonHex(fingerprint[:]),
+		cert:        cert,
+	}
+}
+
+// DecodeCertificates decodes every CERTIFICATE block in the properties,
+// properties are visited in name order and chains are kept in order.  The
+// warnings are for blocks that aren't valid certificates.
+func DecodeCertificates(props map[string]string) ([]*CertificateInfo, []string) {
+	var certs []*CertificateInfo
+	var warnings []string
+
+	names := make([]string, 0)
+	for name, val := range props {
+		if strings.Contains(val, "-----BEGIN CERTIFICATE-----") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// NB: ParseShow keeps the indentation, pem.Decode wants it gone
+		lines := strings.Split(props[name], "\n")
+		for idx, line := range lines {
+			lines[idx] = strings.TrimSpace(line)
+		}
+		rest := []byte(strings.Join(lines, "\n"))
+
+		for index := 0; ; index++ {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				if strings.Contains(string(rest), "-----BEGIN CERTIFICATE-----") {
+					warnings = append(warnings, fmt.Sprintf("Properties.%s: certificate %d isn't valid PEM", name, index))
+				}
+				break
+			}
+
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("Properties.%s: certificate %d: %s", name, index, err))
+				continue
+			}
+
+			certs = append(certs, NewCertificateInfo(name, index, cert))
+		}
+	}
+
+	return certs, warnings
+}
+
+// certificateName is the common name, or the whole name if there isn't one
+func certificateName(cn, name string) string {
+	if cn != "" {
+		return cn
+	}
+	return name
+}
+
+// fillFromCertificates sets ExpiresAt to the soonest NotAfter of all the
+// certificates, a chain is no good once any of it has expired, and
+// IssuedBy/IssuedTo from the leaf (the first certificate that isn't a CA)
+func fillFromCertificates(all []*CertificateInfo, set func(field, val, source string), isSet func(field string) bool) {
+	// NB: certificates read back from json haven't been decoded
+	certs := make([]*CertificateInfo, 0)
+	for _, c := range all {
+		if c.cert != nil {
+			certs = append(certs, c)
+		}
+	}
+
+	if len(certs) == 0 {
+		return
+	}
+
+	if !isSet("ExpiresAt") {
+		soonest := certs[0]
+		for _, c := range certs[1:] {
+			if c.cert.NotAfter.Before(soonest.cert.NotAfter) {
+				soonest = c
+			}
+		}
+		set("ExpiresAt", string(soonest.NotAfter), fmt.Sprintf("Properties.%s[%d].NotAfter", soonest.Property, soonest.Index))
+	}
+
+	leaf := certs[0]
+	for _, c := range certs {
+		if !c.cert.IsCA {
+			leaf = c
+			break
+		}
+	}
+
+	if !isSet("IssuedBy") {
+		set("IssuedBy", certificateName(leaf.cert.Issuer.CommonName, leaf.Issuer), fmt.Sprintf("Properties.%s[%d].Issuer", leaf.Property, leaf.Index))
+	}
+
+	if !isSet("IssuedTo") {
+		set("IssuedTo", certificateName(leaf.cert.Subject.CommonName, leaf.Subject), fmt.Sprintf("Properties.%s[%d].Subject", leaf.Property, leaf.Index))
+	}
+}
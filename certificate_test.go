@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificate signs a certificate with parent/parentKey, or self signs
+// it when parent is nil, and returns it PEM encoded
+func testCertificate(t *testing.T, tmpl *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key, strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+}
+
+// testCertificateChain returns a leaf for www.some.where and the CA that
+// signed it, the CA expires first
+func testCertificateChain(t *testing.T, leafExpires time.Time) (leaf *x509.Certificate, leafPem, caPem string) {
+	ca, caKey, caPem := testCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Some Where CA", Organization: []string{"Some Where"}},
+		NotBefore:             time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              leafExpires.AddDate(0, 0, -1),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+
+	leaf, _, leafPem = testCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(0x1f2e3d),
+		Subject:      pkix.Name{CommonName: "www.some.where"},
+		DNSNames:     []string{"www.some.where", "some.where"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+		NotBefore:    time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     leafExpires,
+	}, ca, caKey)
+
+	return leaf, leafPem, caPem
+}
+
+func TestParseShowDecodesCertificates(t *testing.T) {
+	leaf, leafPem, caPem := testCertificateChain(t, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+
+	note, err := ParseShow("My-certs/www [id: 123]\n" +
+		"Certificate Chain: " + leafPem + "\n" + caPem + "\n" +
+		`Notes: {"Name": "www", "Owner": "web"}` + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(note.Certificates) != 2 {
+		t.Fatalf("Error: expected the leaf and the CA, got %+v", note.Certificates)
+	}
+
+	info := note.Certificates[0]
+	fingerprint := sha256.Sum256(leaf.Raw)
+	if info.Property != "Certificate Chain" || info.Index != 0 || info.Subject != "CN=www.some.where" ||
+		info.Issuer != "CN=Some Where CA,O=Some Where" || info.Serial != "1F:2E:3D" ||
+		info.NotBefore != "2024-06-01T00:00:00Z" || info.NotAfter != "2026-06-01T00:00:00Z" ||
+		info.Fingerprint != colonHex(fingerprint[:]) {
+		t.Errorf("Error: unexpected certificate info %+v", info)
+	}
+
+	if strings.Join(info.SANs, ",") != "www.some.where,some.where,10.0.0.1" {
+		t.Errorf("Error: unexpected SANs %q", info.SANs)
+	}
+
+	cred := note.Credential
+	if cred.ExpiresAt != "2026-05-31T00:00:00Z" || cred.IssuedBy != "Some Where CA" || cred.IssuedTo != "www.some.where" {
+		t.Errorf("Error: expected the Credential to be filled from the chain, got %+v", cred)
+	}
+
+	if note.CredentialSources["ExpiresAt"] != "Properties.Certificate Chain[1].NotAfter" || note.CredentialSources["IssuedTo"] != "Properties.Certificate Chain[0].Subject" {
+		t.Errorf("Error: unexpected CredentialSources %+v", note.CredentialSources)
+	}
+
+	if !strings.Contains(string(note.ToJson()), `"Fingerprint": "`+info.Fingerprint+`"`) {
+		t.Errorf("Error: expected the certificates in the json output, got:\n%s", note.ToJson())
+	}
+}
+
+func TestCertificateDoesNotOverrideNotes(t *testing.T) {
+	_, leafPem, _ := testCertificateChain(t, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+
+	note, err := ParseShow("My-certs/www [id: 123]\n" +
+		"Certificate: " + leafPem + "\n" +
+		`Notes: {"Name": "www", "Owner": "web", "ExpiresAt": "2026-01-01", "IssuedTo": "the web team"}` + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if note.Credential.ExpiresAt != "2026-01-01" || note.Credential.IssuedTo != "the web team" || note.Credential.IssuedBy != "Some Where CA" {
+		t.Errorf("Error: expected the Notes to win over the certificate, got %+v", note.Credential)
+	}
+}
+
+func TestCertificateLeafAfterTheCA(t *testing.T) {
+	_, leafPem, caPem := testCertificateChain(t, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+
+	note, err := ParseShow("My-certs/www [id: 123]\n" +
+		"Certificate Chain: " + caPem + "\n" + leafPem + "\n" +
+		`Notes: {"Name": "www", "Owner": "web"}` + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if note.Credential.IssuedTo != "www.some.where" || note.CredentialSources["IssuedTo"] != "Properties.Certificate Chain[1].Subject" {
+		t.Errorf("Error: expected IssuedTo from the leaf, got %+v / %+v", note.Credential, note.CredentialSources)
+	}
+}
+
+func TestInvalidCertificateIsAWarning(t *testing.T) {
+	data, err := ioutil.ReadFile("fixtures/show/note-with-certificate.out")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	note, err := ParseShow(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(note.Certificates) != 0 || !strings.Contains(strings.Join(note.CredentialWarnings, "\n"), "Properties.Certificate: certificate 0") {
+		t.Errorf("Error: expected a warning about the certificate, got %+v / %q", note.Certificates, note.CredentialWarnings)
+	}
+}
+
+func TestExpiringCertificate(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	_, leafPem, _ := testCertificateChain(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))
+	_, err := fake.Add("My-certs/www", "", "Certificate: "+leafPem+"\nNotes: {\"Name\": \"www\", \"Owner\": \"web\"}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureStdout(t, func() {
+		_, err = lpass.Expiring([]string{}, ExpiringOptions{Within: "30d", Sort: "date", Format: "text", Now: expiringNow})
+	})
+
+	if ExitCodeFor(err) != ExitCodeExpired || !strings.Contains(output, "2025-02-01T00:00:00Z    -15d  web           My-certs/www") {
+		t.Errorf("Error: expected the expired certificate to be reported, got %v:\n%s", err, output)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newFakeLPass(t *testing.T, vault string) (*LPass, *FakeBackend) {
+	fake, err := LoadFakeBackend(filepath.Join("fixtures", "vaults", vault))
+	if err != nil {
+		t.Fatalf("Error loading fixture vault '%s': %s", vault, err)
+	}
+
+	// NB: keep the search index key out of the real ~/.rlpass
+	tmpdir := t.TempDir()
+	t.Setenv("HOME", tmpdir)
+	t.Setenv("RLPASS_INDEX_KEY", "")
+
+	lpass := &LPass{
+		Username:          fake.Username,
+		Cachedir:          filepath.Join(tmpdir, "cache"),
+		CredentialsFolder: filepath.Join(tmpdir, "credentials"),
+		Backend:           fake,
+	}
+
+	err = os.MkdirAll(lpass.Cachedir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return lpass, fake
+}
+
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		done <- data
+	}()
+
+	fn()
+	w.Close()
+	return string(<-done)
+}
+
+func TestFakeBackendServesListFormat(t *testing.T) {
+	_, fake := newFakeLPass(t, "basic")
+	ent := fake.Find("5926414273882541009")
+	if ent == nil {
+		t.Fatal("Error: expected the tivo.com entry in the basic vault")
+	}
+
+	actual := ent.Format("%/ai\t%/an\t%/aN\t%/au\t%/as")
+	expected := "5926414273882541009/\ttivo.com/\t(none)/tivo.com/\tme@some.where/\t"
+	if actual != expected {
+		t.Errorf("Error: expected Format to be '%s', got '%s'", expected, actual)
+	}
+}
+
+func TestListCommand(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.List([]string{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []*LPassEntry
+	err = json.Unmarshal([]byte(output), &entries)
+	if err != nil {
+		t.Fatalf("Error: list did not emit json: %s\n%s", err, output)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("Error: expected 3 entries, got %d", len(entries))
+	}
+
+	if entries[0].AccountNameIncludingPath != "Shared-Infra/aws/deploy-key" {
+		t.Errorf("Error: expected the first entry to be Shared-Infra/aws/deploy-key, got '%s'",
+			entries[0].AccountNameIncludingPath)
+	}
+
+	if entries[0].AccountShareName != "Shared-Infra" {
+		t.Errorf("Error: expected AccountShareName=Shared-Infra, got '%s'", entries[0].AccountShareName)
+	}
+}
+
+func TestShowCommand(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Show([]string{"4281390154665116890"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var note LPassSecureNote
+	err = json.Unmarshal([]byte(output), &note)
+	if err != nil {
+		t.Fatalf("Error: show did not emit json: %s\n%s", err, output)
+	}
+
+	if note.EntryInfo.AccountName != "Test Note for Notes" {
+		t.Errorf("Error: expected AccountName='Test Note for Notes', got '%s'", note.EntryInfo.AccountName)
+	}
+
+	if note.GetString("Owner") != "platform" {
+		t.Errorf("Error: expected Notes.Owner='platform', got '%s'", note.GetString("Owner"))
+	}
+}
+
+func TestShowCommandUnknownEntry(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	_, err := lpass.Show([]string{"no-such-entry"})
+	if err == nil {
+		t.Error("Error: expected show of an unknown entry to fail")
+	}
+}
+
+func TestFetchCommand(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	captureStdout(t, func() {
+		lpass.Fetch([]string{"tivo.com"})
+	})
+
+	fname := filepath.Join(lpass.CredentialsFolder, "-none-", "tivo.com", "credential.json")
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatalf("Error: expected fetch to write %s: %s", fname, err)
+	}
+
+	var note LPassSecureNote
+	err = json.Unmarshal(data, &note)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if note.Properties["Username"] != "me@some.where" {
+		t.Errorf("Error: expected Properties.Username=me@some.where, got '%s'", note.Properties["Username"])
+	}
+
+	// NB: the Credential is derived, an edit to it would be silently ignored by sync-up
+	if note.Credential != nil || note.Certificates != nil {
+		t.Errorf("Error: expected the read only views to be left out of %s, got:\n%s", fname, data)
+	}
+}
+
+func TestSyncToLocalCommand(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+
+	captureStdout(t, func() {
+		lpass.SyncToLocal([]string{}, SyncDownOptions{})
+	})
+
+	for _, ent := range fake.Entries {
+		fname := filepath.Join(lpass.CredentialsFolder, ScrubPathOfSpecialCharacters(ent.Path), "credential.json")
+		if !FileExists(fname) {
+			t.Errorf("Error: expected sync-down to write %s", fname)
+		}
+	}
+
+	if len(fake.Mutations) != 0 {
+		t.Errorf("Error: expected sync-down not to modify the vault, got %+v", fake.Mutations)
+	}
+}
+
+func TestSyncToLocalParallel(t *testing.T) {
+	serial, _ := newFakeLPass(t, "basic")
+	expected := captureStdout(t, func() {
+		serial.SyncToLocal([]string{}, SyncDownOptions{Parallel: 1})
+	})
+
+	lpass, _ := newFakeLPass(t, "basic")
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.SyncToLocal([]string{}, SyncDownOptions{Parallel: 8})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NB: the credentials folders differ, so compare the relative paths
+	expected = strings.Replace(expected, serial.CredentialsFolder, "", -1)
+	output = strings.Replace(output, lpass.CredentialsFolder, "", -1)
+	if output != expected {
+		t.Errorf("Error: expected the parallel output to match the serial output:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+func TestSyncToLocalAggregatesErrors(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+
+	fake.ShowErrors = map[string]error{
+		"5926414273882541009":    ErrEntryNotFound,
+		"3172274455914884164282": ErrEntryNotFound,
+	}
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.SyncToLocal([]string{}, SyncDownOptions{Parallel: 2})
+	})
+
+	if !errors.Is(err, ErrEntryNotFound) || !strings.Contains(err.Error(), "(none)/tivo.com") || !strings.Contains(err.Error(), "Shared-Infra/aws/deploy-key") {
+		t.Errorf("Error: expected both missing entries to be reported, got %v", err)
+	}
+
+	if !strings.Contains(output, "done, 1 added, 0 changed, 0 removed, 0 unchanged, 2 errors.") {
+		t.Errorf("Error: expected the remaining entry to be saved, got:\n%s", output)
+	}
+}
+
+func TestFakeBackendRecordsMutations(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+
+	id, err := fake.Add("Test/new entry", "", "Username: someone\nPassword: secret\nNotes:\n{\"Name\": \"new entry\"}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	note, err := lpass.GetSecureNote(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if note.Properties["Username"] != "someone" || note.GetString("Name") != "new entry" {
+		t.Errorf("Error: added entry did not round trip, got %+v", note)
+	}
+
+	err = fake.Edit(id, "Password", "changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = fake.Remove(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := []string{}
+	for _, mutation := range fake.Mutations {
+		ops = append(ops, mutation.Op)
+	}
+
+	if len(ops) != 3 || ops[0] != "add" || ops[1] != "edit" || ops[2] != "rm" {
+		t.Errorf("Error: expected add, edit, rm mutations, got %q", ops)
+	}
+}
+
+func TestAutoLoginWhenSessionExpired(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	fake.LoggedIn = false
+	lpass.AutoLogin = true
+	lpass.Stdin = strings.NewReader("y\n")
+
+	entries, err := lpass.GetList([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fake.LoggedIn || len(entries) != 3 {
+		t.Errorf("Error: expected to login and list 3 entries, got LoggedIn=%v, %d entries", fake.LoggedIn, len(entries))
+	}
+}
+
+func TestAutoLoginDeclined(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	fake.LoggedIn = false
+	lpass.AutoLogin = true
+	lpass.Stdin = strings.NewReader("n\n")
+
+	_, err := lpass.GetSecureNote("tivo.com")
+	if !errors.Is(err, ErrNotLoggedIn) || fake.LoggedIn {
+		t.Errorf("Error: expected ErrNotLoggedIn without logging in, got %v", err)
+	}
+}
+
+func TestSyncToLocalIncremental(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+
+	syncDown := func(opts SyncDownOptions) string {
+		return captureStdout(t, func() {
+			_, err := lpass.SyncToLocal([]string{}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	output := syncDown(SyncDownOptions{})
+	if !strings.Contains(output, "done, 3 added, 0 changed, 0 removed, 0 unchanged") {
+		t.Fatalf("Error: expected the first sync-down to add everything, got:\n%s", output)
+	}
+
+	tivo := filepath.Join(lpass.CredentialsFolder, "-none-", "tivo.com", "credential.json")
+	err := os.Remove(tivo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ent := fake.Find("deploy-key")
+	ent.Set("Username", "deployer")
+	fake.Touch(ent)
+
+	output = syncDown(SyncDownOptions{})
+	if !strings.Contains(output, "Saving off 2 of 3 entries") || !strings.Contains(output, "done, 0 added, 2 changed, 0 removed, 1 unchanged") {
+		t.Errorf("Error: expected only the touched and missing entries to be fetched, got:\n%s", output)
+	}
+
+	if !FileExists(tivo) {
+		t.Errorf("Error: expected the missing %s to be fetched again", tivo)
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(lpass.CredentialsFolder, "Shared-Infra", "aws", "deploy-key", "credential.json"))
+	if !strings.Contains(string(data), `"Username": "deployer"`) {
+		t.Errorf("Error: expected the changed entry to be fetched, got:\n%s", data)
+	}
+
+	fake.Remove("tivo.com")
+
+	output = syncDown(SyncDownOptions{})
+	if !FileExists(tivo) || !strings.Contains(output, "use --prune") {
+		t.Errorf("Error: expected the removed entry to be kept without --prune, got:\n%s", output)
+	}
+
+	output = syncDown(SyncDownOptions{Prune: true})
+	if FileExists(tivo) || !strings.Contains(output, "done, 0 added, 0 changed, 1 removed, 2 unchanged") {
+		t.Errorf("Error: expected --prune to remove %s, got:\n%s", tivo, output)
+	}
+}
+
+func TestGetListAwkwardValues(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+
+	awkward := &FakeEntry{
+		Id:   "1065230732160897586",
+		Path: "Test/tabs\tand/slashes/",
+		Fields: []*FakeField{
+			{Name: "Username", Value: "me/"},
+			{Name: "Password", Value: "multi\nline\tpass/"},
+		},
+	}
+	fake.Touch(awkward)
+	fake.Entries = append(fake.Entries, awkward)
+
+	entries, err := lpass.GetList([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 4 {
+		t.Fatalf("Error: expected 4 entries, got %d", len(entries))
+	}
+
+	ent := entries[3]
+	if ent.AccountNameIncludingPath != awkward.Path || ent.AccountUser != "me/" || ent.AccountPassword != "multi\nline\tpass/" {
+		t.Errorf("Error: expected the values to survive intact, got %+v", ent)
+	}
+
+	// NB: and again from the cache
+	cached, err := lpass.GetList([]string{})
+	if err != nil || *cached[3] != *ent {
+		t.Errorf("Error: expected the cached listing to match, got %+v / %v", cached[3], err)
+	}
+}
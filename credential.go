@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The StandardCredential of a note is filled from, in order:
+//
+//   the Username, Password and URL properties, they're the lastpass fields
+//   the top level keys of the Notes json with the same name as the field
+//   the properties of a built in note type that have a cred tag (see NoteTypes)
+//   the X.509 certificates in the properties (see fillFromCertificates)
+//
+// the first non-empty value wins.  CredentialSources records where each
+// field came from, eg: "Owner": "Notes.Owner", "Url": "Properties.URL"
+
+var credentialProperties = map[string]string{
+	"Username": "Username",
+	"Password": "Password",
+	"Url":      "URL",
+}
+
+// credentialDateFields are normalized to credentialDateLayout or, if they
+// have a time of day, RFC3339
+var credentialDateFields = map[string]bool{
+	"IssuedAt":      true,
+	"ExpiresAt":     true,
+	"LastRotatedAt": true,
+}
+
+const credentialDateLayout = "2006-01-02"
+
+var credentialDateTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+func standardCredentialFieldNames() []string {
+	names := make([]string, 0)
+	typ := reflect.TypeOf(StandardCredential{})
+	for idx := 0; idx < typ.NumField(); idx++ {
+		names = append(names, typ.Field(idx).Name)
+	}
+	return names
+}
+
+// Timestamp is a StandardCredential date, it's kept as the string from the
+// Notes (see ParseCredentialDate for the forms it can take)
+type Timestamp string
+
+// Time parses the timestamp, a date without a time of day is midnight UTC
+func (self Timestamp) Time() (time.Time, error) {
+	t, _, err := parseCredentialTime(string(self))
+	return t, err
+}
+
+func (self Timestamp) IsZero() bool {
+	return strings.TrimSpace(string(self)) == ""
+}
+
+// UnmarshalJSON takes a unix timestamp as well as a string, as the schema
+// does.  Strings are kept as they are, ValidateNotes reports bad dates.
+func (self *Timestamp) UnmarshalJSON(data []byte) error {
+	var val interface{}
+	err := json.Unmarshal(data, &val)
+	if err != nil {
+		return err
+	}
+
+	switch v := val.(type) {
+	case nil:
+		*self = ""
+	case string:
+		*self = Timestamp(v)
+	case float64:
+		normal, _ := ParseCredentialDate(v)
+		*self = Timestamp(normal)
+	default:
+		return fmt.Errorf("expected a date, got %T", val)
+	}
+
+	return nil
+}
+
+// creditCardDateLayout is how lpass stores a credit card's Expiration Date,
+// the card is good until the end of the month
+const creditCardDateLayout = "January,2006"
+
+func parseCredentialTime(s string) (t time.Time, dateOnly bool, err error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(credentialDateLayout, s); err == nil {
+		return t, true, nil
+	}
+
+	if t, err := time.Parse(creditCardDateLayout, s); err == nil {
+		return t.AddDate(0, 1, -1), true, nil
+	}
+
+	for _, layout := range credentialDateTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, false, nil
+		}
+	}
+
+	return time.Time{}, false, fmt.Errorf("'%s' is not a date, expected YYYY-MM-DD or RFC3339", s)
+}
+
+// ParseCredentialDate accepts a date, a date and time, or (from the Notes
+// json) a unix timestamp and returns it in its normal form
+func ParseCredentialDate(val interface{}) (string, error) {
+	switch v := val.(type) {
+	case float64:
+		return time.Unix(int64(v), 0).UTC().Format(time.RFC3339), nil
+	case string:
+		t, dateOnly, err := parseCredentialTime(v)
+		if err != nil {
+			return "", err
+		}
+
+		if dateOnly {
+			return t.Format(credentialDateLayout), nil
+		}
+		return t.Format(time.RFC3339), nil
+	}
+
+	return "", fmt.Errorf("expected a date, got %T", val)
+}
+
+// BuildStandardCredential fills every StandardCredential field it can find
+// a value for, along with where each value came from and warnings about
+// Notes keys that were ignored or values that had to be guessed at
+func BuildStandardCredential(note *LPassSecureNote) (*StandardCredential, map[string]string, []string) {
+	cred := &StandardCredential{}
+	dst := reflect.ValueOf(cred).Elem()
+	sources := make(map[string]string)
+	warnings := make([]string, 0)
+
+	set := func(field, val, source string) {
+		if val == "" {
+			return
+		}
+
+		if credentialDateFields[field] {
+			normal, err := ParseCredentialDate(val)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: %s", source, err))
+			} else {
+				val = normal
+			}
+		}
+
+		dst.FieldByName(field).SetString(val)
+		sources[field] = source
+	}
+
+	for field, prop := range credentialProperties {
+		set(field, note.Properties[prop], "Properties."+prop)
+	}
+
+	if note.notesErr != nil {
+		warnings = append(warnings, fmt.Sprintf("Notes: is not json: %s", note.notesErr))
+	}
+
+	notes, ok := note.Notes.(map[string]interface{})
+	if !ok && note.Notes != nil {
+		warnings = append(warnings, fmt.Sprintf("Notes: expected a json object, got %T", note.Notes))
+	}
+
+	known := make(map[string]bool)
+	for _, name := range standardCredentialFieldNames() {
+		known[name] = true
+	}
+
+	keys := make([]string, 0)
+	for k := range notes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		source := "Notes." + k
+		if strings.HasPrefix(k, "_") || notes[k] == nil {
+			continue
+		}
+
+		if !known[k] {
+			warnings = append(warnings, fmt.Sprintf("%s: not a StandardCredential field, ignored", source))
+			continue
+		}
+
+		switch val := notes[k].(type) {
+		case string:
+			if sources[k] == "" {
+				set(k, val, source)
+			} else if dst.FieldByName(k).String() != val {
+				// NB: the values aren't in the warning, the field might be a secret
+				warnings = append(warnings, fmt.Sprintf("%s: differs from %s, using %s", source, sources[k], sources[k]))
+			}
+		case float64:
+			if !credentialDateFields[k] {
+				warnings = append(warnings, fmt.Sprintf("%s: expected a string, got a number, ignored", source))
+				continue
+			}
+			normal, _ := ParseCredentialDate(val)
+			dst.FieldByName(k).SetString(normal)
+			sources[k] = source
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s: expected a string, got %T, ignored", source, val))
+		}
+	}
+
+	if nt := note.NoteType(); nt != nil {
+		typed := reflect.ValueOf(nt.ToStandardCredential(nt.FromProperties(note.Properties))).Elem()
+		for idx := 0; idx < nt.Type.NumField(); idx++ {
+			field, prop := nt.Type.Field(idx).Tag.Get("cred"), nt.Type.Field(idx).Tag.Get("lpass")
+			if field != "" && sources[field] == "" {
+				set(field, typed.FieldByName(field).String(), "Properties."+prop)
+			}
+		}
+	}
+
+	fillFromCertificates(note.Certificates, set, func(field string) bool {
+		return sources[field] != ""
+	})
+
+	if len(warnings) == 0 {
+		warnings = nil
+	}
+
+	return cred, sources, warnings
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildStandardCredentialFromNotes(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("fixtures", "vaults", "basic", "deploy-key.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	note, err := ParseShow(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &StandardCredential{
+		Name:        "deploy-key",
+		Owner:       "infra",
+		Description: "CI deploy credentials",
+		Usage:       "used by the release pipeline",
+		Username:    "deploy",
+		Password:    "l0ew0i1fkhxas5s9yf8n8z5v0v2l",
+		Url:         "https://console.aws.amazon.com",
+	}
+	if !reflect.DeepEqual(note.Credential, expected) {
+		t.Errorf("Error: expected Credential=%+v, got %+v", expected, note.Credential)
+	}
+
+	if note.CredentialSources["Owner"] != "Notes.Owner" || note.CredentialSources["Url"] != "Properties.URL" {
+		t.Errorf("Error: unexpected CredentialSources %+v", note.CredentialSources)
+	}
+
+	if note.CredentialWarnings != nil {
+		t.Errorf("Error: expected no warnings, got %q", note.CredentialWarnings)
+	}
+}
+
+func TestBuildStandardCredentialWarnings(t *testing.T) {
+	note, err := ParseSecureNoteJson([]byte(`{
+	  "Properties": {"Username": "deploy", "NoteType": "Credit Card", "Name on Card": "Some Body", "Expiration Date": "June,2027"},
+	  "Notes": {
+	    "Name": "x",
+	    "Owner": ["infra"],
+	    "IssuedAt": "2021-03-04",
+	    "LastRotatedAt": "2022-01-02 03:04:05",
+	    "ExpiresAt": 1700000000,
+	    "Username": "someone-else",
+	    "Usage": 7,
+	    "Colour": "blue",
+	    "_comment": "ignored"
+	  }
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cred, sources, warnings := BuildStandardCredential(note)
+
+	if cred.IssuedAt != "2021-03-04" || cred.LastRotatedAt != "2022-01-02T03:04:05Z" || cred.ExpiresAt != "2023-11-14T22:13:20Z" {
+		t.Errorf("Error: expected the dates to be normalized, got %+v", cred)
+	}
+
+	if cred.Username != "deploy" || sources["Username"] != "Properties.Username" {
+		t.Errorf("Error: expected the Username property to win, got '%s' from %s", cred.Username, sources["Username"])
+	}
+
+	if cred.IssuedTo != "Some Body" || sources["IssuedTo"] != "Properties.Name on Card" {
+		t.Errorf("Error: expected IssuedTo from the credit card, got '%s' from %s", cred.IssuedTo, sources["IssuedTo"])
+	}
+
+	if cred.Owner != "" || cred.Usage != "" {
+		t.Errorf("Error: expected values that aren't strings to be ignored, got %+v", cred)
+	}
+
+	expected := []string{
+		"Notes.Colour: not a StandardCredential field, ignored",
+		"Notes.Owner: expected a string, got []interface {}, ignored",
+		"Notes.Usage: expected a string, got a number, ignored",
+		"Notes.Username: differs from Properties.Username, using Properties.Username",
+	}
+	if strings.Join(warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Error: expected warnings:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(warnings, "\n"))
+	}
+}
+
+func TestMergeIgnoresCredentialFromNotes(t *testing.T) {
+	note, err := ParseSecureNoteJson([]byte(`{"Properties": {}, "Notes": {"Name": "x", "Owner": "infra", "Username": "from-notes"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	note.rebuildViews()
+
+	merged, err := MergeSecureNotePatch(note, note.ToJson())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changes := DiffSecureNotes(note, merged); len(changes) != 0 {
+		t.Errorf("Error: expected a full document to be no change, got %s", changes)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func editorCommand() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.Fields(os.Getenv(name)); len(editor) > 0 {
+			return editor
+		}
+	}
+
+	return []string{"vi"}
+}
+
+func runEditor(fname string) error {
+	editor := editorCommand()
+	childProc := exec.Command(editor[0], append(editor[1:], fname)...)
+	childProc.Stdin = os.Stdin
+	childProc.Stdout = os.Stdout
+	childProc.Stderr = os.Stderr
+	return childProc.Run()
+}
+
+// ReplaceSecureNote is MergeSecureNotePatch for a complete document: the
+// edited Notes replace the current ones, so removed keys are removed.
+func ReplaceSecureNote(current *LPassSecureNote, data []byte) (*LPassSecureNote, error) {
+	edited, err := ParseSecureNoteJson(data)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := MergeSecureNotePatch(current, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if edited.Notes == nil {
+		merged.Notes = nil
+		merged.rebuildViews()
+		return merged, nil
+	}
+
+	notes, ok := edited.Notes.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected Notes to be a json object")
+	}
+
+	for k := range notes {
+		if strings.HasPrefix(k, "_") {
+			delete(notes, k)
+		}
+	}
+	merged.Notes = notes
+	merged.rebuildViews()
+
+	return merged, nil
+}
+
+// NB: the temp file holds secrets, it's removed on return and on ^C
+func (self *LPass) editInTempFile(note *LPassSecureNote, validate func([]byte) (*LPassSecureNote, error)) (*LPassSecureNote, error) {
+	f, err := ioutil.TempFile("", "rlpass-edit-*.json")
+	if err != nil {
+		return nil, err
+	}
+	fname := f.Name()
+	defer os.Remove(fname)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+	go func() {
+		if _, ok := <-signals; ok {
+			os.Remove(fname)
+			os.Exit(ExitCodeError)
+		}
+	}()
+
+	data, err := note.EditableJson()
+	if err == nil {
+		err = f.Chmod(0600)
+	}
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		err = runEditor(fname)
+		if err != nil {
+			return nil, fmt.Errorf("editor %q failed: %s", editorCommand(), err)
+		}
+
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+
+		edited, err := validate(data)
+		if err == nil {
+			return edited, nil
+		}
+
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		if !self.confirm("Edit again?") {
+			return nil, fmt.Errorf("edit aborted: %s", err)
+		}
+	}
+}
+
+func (self *LPass) Edit(args []string) (*exec.Cmd, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("Error: you must supply a ID or name")
+	}
+
+	current, err := self.GetSecureNote(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkNotesAreJson(current, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	edited, err := self.editInTempFile(current, func(data []byte) (*LPassSecureNote, error) {
+		edited, err := ReplaceSecureNote(current, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return edited, ValidateSecureNote(edited)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	changes := DiffSecureNotes(current, edited)
+	if len(changes) == 0 {
+		fmt.Printf("No changes.\n")
+		return nil, nil
+	}
+
+	printChanges(changes)
+
+	err = self.applyChanges(current.EntryInfo.AccountId, edited, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeEditor installs a shell script as $EDITOR, the script's $1 is the file being edited
+func fakeEditor(t *testing.T, script string) string {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "editor.sh")
+	err := ioutil.WriteFile(fname, []byte("#!/bin/sh\nset -e\ncd "+dir+"\n"+script), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", fname)
+	return dir
+}
+
+func TestEditPushesChangedFields(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	dir := fakeEditor(t, `
+echo "$1" > edited-file
+stat -c %a "$1" > edited-perms
+sed -i -e 's/"Owner": "infra",/"Owner": "platform"/' -e '/"Usage"/d' "$1"
+`)
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Edit([]string{"deploy-key"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	perms, _ := ioutil.ReadFile(filepath.Join(dir, "edited-perms"))
+	if strings.TrimSpace(string(perms)) != "600" {
+		t.Errorf("Error: expected the temp file to be 0600, got '%s'", perms)
+	}
+
+	tmpfile, _ := ioutil.ReadFile(filepath.Join(dir, "edited-file"))
+	if FileExists(strings.TrimSpace(string(tmpfile))) {
+		t.Errorf("Error: expected the temp file %s to be removed", tmpfile)
+	}
+
+	if !strings.Contains(output, `~ Notes.Owner: "infra" -> "platform"`) || !strings.Contains(output, "- Notes.Usage") {
+		t.Errorf("Error: expected the diff to show the Owner and Usage changes, got:\n%s", output)
+	}
+
+	if len(fake.Mutations) != 1 || fake.Mutations[0].Field != "Notes" {
+		t.Fatalf("Error: expected a single edit of the Notes, got %+v", fake.Mutations)
+	}
+
+	var notes map[string]string
+	err = json.Unmarshal([]byte(fake.Mutations[0].Value), &notes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := notes["Usage"]; ok || notes["Owner"] != "platform" {
+		t.Errorf("Error: unexpected Notes after edit: %+v", notes)
+	}
+}
+
+func TestEditLoopsBackOnInvalidJson(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	lpass.Stdin = strings.NewReader("y\n")
+	fakeEditor(t, `
+if [ ! -e first-run ]; then
+  touch first-run
+  echo '{"Notes": ' > "$1"
+  exit 0
+fi
+sed -i 's/"platform"/"infra"/' "$1"
+`)
+
+	var err error
+	captureStdout(t, func() {
+		_, err = lpass.Edit([]string{"Test Note for Notes"})
+	})
+
+	// NB: the second run re-edits the broken file, so it is still broken
+	// and the second "Edit again?" is answered with a no
+	if err == nil {
+		t.Fatalf("Error: expected the edit to fail, got mutations %+v", fake.Mutations)
+	}
+
+	if !strings.Contains(err.Error(), "edit aborted") || len(fake.Mutations) != 0 {
+		t.Errorf("Error: expected the edit to be aborted without changes, got %v / %+v", err, fake.Mutations)
+	}
+}
+
+func TestEditRejectsSchemaErrorsUntilFixed(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	lpass.Stdin = strings.NewReader("y\n")
+	fakeEditor(t, `
+if [ ! -e first-run ]; then
+  touch first-run
+  sed -i 's/"Owner"/"Colour"/' "$1"
+  exit 0
+fi
+sed -i 's/"Colour": "platform"/"Owner": "infra"/' "$1"
+`)
+
+	var err error
+	captureStdout(t, func() {
+		_, err = lpass.Edit([]string{"Test Note for Notes"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.Mutations) != 1 || !strings.Contains(fake.Mutations[0].Value, `"Owner": "infra"`) {
+		t.Errorf("Error: expected the fixed Notes to be saved, got %+v", fake.Mutations)
+	}
+}
+
+func TestEditLeavesOutTheReadOnlyViews(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	dir := fakeEditor(t, `cp "$1" seen.json`)
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Edit([]string{"deploy-key"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen, _ := ioutil.ReadFile(filepath.Join(dir, "seen.json"))
+	var doc map[string]interface{}
+	err = json.Unmarshal(seen, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range []string{"Credential", "CredentialSources", "CredentialWarnings", "Typed", "Certificates"} {
+		if _, ok := doc[k]; ok {
+			t.Errorf("Error: expected %s to be left out of the temp file, got:\n%s", k, seen)
+		}
+	}
+
+	if _, ok := doc["Notes"]; !ok {
+		t.Errorf("Error: expected the Notes in the temp file, got:\n%s", seen)
+	}
+
+	if !strings.Contains(output, "No changes.") || len(fake.Mutations) != 0 {
+		t.Errorf("Error: expected an unchanged file to make no changes, got %+v / %s", fake.Mutations, output)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+var (
+	ErrNotLoggedIn    = errors.New("lpass: not logged in, try `rlpass login`")
+	ErrBinaryNotFound = errors.New("lpass: unable to find the lpass binary")
+	ErrEntryNotFound  = errors.New("lpass: entry not found")
+)
+
+// ParseError is returned by the lpass output parsers, Line is 1 based.
+type ParseError struct {
+	Line int
+	Text string
+	Msg  string
+}
+
+func (self *ParseError) Error() string {
+	return fmt.Sprintf("parse error on line %d: %s: '%s'", self.Line, self.Msg, self.Text)
+}
+
+type CacheError struct {
+	Op   string
+	Key  string
+	Path string
+	Err  error
+}
+
+func (self *CacheError) Error() string {
+	return fmt.Sprintf("cache %s failed for key %s (%s): %s", self.Op, self.Key, self.Path, self.Err)
+}
+
+func (self *CacheError) Unwrap() error {
+	return self.Err
+}
+
+// ValidationError is a note that doesn't match the StandardCredential schema
+type ValidationError struct {
+	Violations []*SchemaViolation
+	Msg        string
+}
+
+func (self *ValidationError) Error() string {
+	if self.Msg != "" {
+		return self.Msg
+	}
+
+	msgs := make([]string, 0)
+	for _, v := range self.Violations {
+		msgs = append(msgs, v.String())
+	}
+
+	return "invalid StandardCredential: " + strings.Join(msgs, "; ")
+}
+
+// ExpiredError is returned by `rlpass expiring` when a credential has expired
+type ExpiredError struct {
+	Count int
+}
+
+func (self *ExpiredError) Error() string {
+	return fmt.Sprintf("%d credentials have expired", self.Count)
+}
+
+// LPassError is a failed lpass invocation.  Err is one of the Err* values
+// above when the failure was recognized from lpass's output.
+type LPassError struct {
+	Args     []string
+	ExitCode int
+	Stderr   string
+	Message  string
+	Err      error
+}
+
+// NB: lpass reports most failures on stderr, but `lpass status` reports on stdout
+var lpassErrorMessages = []struct {
+	Message string
+	Err     error
+}{
+	{"Could not find decryption key", ErrNotLoggedIn},
+	{"Perhaps you need to login", ErrNotLoggedIn},
+	{"Not logged in", ErrNotLoggedIn},
+	{"Could not find specified account", ErrEntryNotFound},
+}
+
+func ClassifyLPassOutput(output string) error {
+	for _, known := range lpassErrorMessages {
+		if strings.Contains(output, known.Message) {
+			return known.Err
+		}
+	}
+
+	return nil
+}
+
+func NewLPassError(args []string, err error, stdout, stderr string) *LPassError {
+	lerr := &LPassError{
+		Args:     args,
+		ExitCode: -1,
+		Stderr:   strings.TrimSpace(stderr),
+		Err:      ClassifyLPassOutput(stderr + "\n" + stdout),
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		lerr.ExitCode = exitErr.ExitCode()
+	}
+
+	lerr.Message = lerr.Stderr
+	if lerr.Message == "" {
+		lerr.Message = strings.TrimSpace(stdout)
+	}
+	if lerr.Message == "" {
+		lerr.Message = err.Error()
+	}
+
+	return lerr
+}
+
+func (self *LPassError) Error() string {
+	cmd := "lpass"
+	if len(self.Args) > 0 {
+		cmd = "lpass " + self.Args[0]
+	}
+
+	if self.Err != nil {
+		return fmt.Sprintf("%s: %s (%s exited %d)", self.Err, self.Message, cmd, self.ExitCode)
+	}
+
+	return fmt.Sprintf("%s exited %d: %s", cmd, self.ExitCode, self.Message)
+}
+
+func (self *LPassError) Unwrap() error {
+	return self.Err
+}
+
+const (
+	ExitCodeOk             = 0
+	ExitCodeError          = 1
+	ExitCodeNotLoggedIn    = 3
+	ExitCodeBinaryNotFound = 4
+	ExitCodeEntryNotFound  = 5
+	ExitCodeParseError     = 6
+	ExitCodeCacheError     = 7
+	ExitCodeInvalid        = 8
+	ExitCodeExpired        = 9
+)
+
+func ExitCodeFor(err error) int {
+	var parseErr *ParseError
+	var cacheErr *CacheError
+	var validationErr *ValidationError
+	var expiredErr *ExpiredError
+
+	switch {
+	case err == nil:
+		return ExitCodeOk
+	case errors.Is(err, ErrNotLoggedIn):
+		return ExitCodeNotLoggedIn
+	case errors.Is(err, ErrBinaryNotFound):
+		return ExitCodeBinaryNotFound
+	case errors.Is(err, ErrEntryNotFound):
+		return ExitCodeEntryNotFound
+	case errors.As(err, &parseErr):
+		return ExitCodeParseError
+	case errors.As(err, &cacheErr):
+		return ExitCodeCacheError
+	case errors.As(err, &validationErr):
+		return ExitCodeInvalid
+	case errors.As(err, &expiredErr):
+		return ExitCodeExpired
+	}
+
+	return ExitCodeError
+}
+
+// cliError converts a command's error into one urfave/cli will exit with
+func cliError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return cli.NewExitError(fmt.Sprintf("Error: %s", err), ExitCodeFor(err))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLPassListReportsLineNumber(t *testing.T) {
+	s1 := "2153813569506231076259/\tGenerated Password for some.where/\t(none)/Generated Password for some.where/\t\tf8w016ehv3vlzedh/\t2016-05-23 18:12/\n" +
+		"this line is not an entry\n"
+
+	_, err := ParseLPassList(s1)
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Error: expected a ParseError, got %v", err)
+	}
+
+	if parseErr.Line != 2 || parseErr.Text != "this line is not an entry" {
+		t.Errorf("Error: expected the ParseError to point at line 2, got %+v", parseErr)
+	}
+}
+
+func TestParseShowFirstLineWithoutProperties(t *testing.T) {
+	_, err := ParseShowFirstLine("(none)/tivo.com")
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 1 {
+		t.Errorf("Error: expected a ParseError on line 1, got %v", err)
+	}
+}
+
+func TestParseShowFirstLineOddNames(t *testing.T) {
+	_, err := ParseShow("[id: 1]\n")
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 1 {
+		t.Errorf("Error: expected a ParseError on line 1 for an entry without a name, got %v", err)
+	}
+
+	note, err := ParseShow("a/[id: 1]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if note.EntryInfo.AccountNameIncludingPath != "a/" || note.EntryInfo.AccountName != "" || note.EntryInfo.AccountId != "1" {
+		t.Errorf("Error: unexpected entry %+v", note.EntryInfo)
+	}
+}
+
+func TestParseShowUnterminatedCertificate(t *testing.T) {
+	s1 := `my-certs/front-end-web [id: 2360023450475626742225]
+Certificate: -----BEGIN CERTIFICATE-----
+2eIWoziwf4CV9B6Jy7+gqJ7S5LleXMI41AlbHoIgHRiMfkYjgjkLShshjjAgJiwT
+NoteType: Custom_1230497198709871246`
+
+	_, err := ParseShow(s1)
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Error: expected a ParseError, got %v", err)
+	}
+
+	if parseErr.Line != 2 {
+		t.Errorf("Error: expected the ParseError to point at line 2, got %+v", parseErr)
+	}
+}
+
+func TestParseShowEmpty(t *testing.T) {
+	_, err := ParseShow("")
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Errorf("Error: expected a ParseError for empty input, got %v", err)
+	}
+}
+
+func TestCacheErrors(t *testing.T) {
+	lpass := &LPass{Cachedir: filepath.Join(t.TempDir(), "does-not-exist")}
+
+	err := lpass.cachePut("List.dat", "data")
+
+	var cacheErr *CacheError
+	if !errors.As(err, &cacheErr) || cacheErr.Op != "write" {
+		t.Errorf("Error: expected a write CacheError, got %v", err)
+	}
+
+	lpass.Cachedir = t.TempDir()
+	err = os.Mkdir(filepath.Join(lpass.Cachedir, "List.dat"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = lpass.cacheGet("List.dat")
+	if !errors.As(err, &cacheErr) || cacheErr.Op != "read" {
+		t.Errorf("Error: expected a read CacheError, got %v", err)
+	}
+}
+
+func TestBinaryNotFound(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	_, err := NewLPassCli().Exec([]string{"ls"})
+	if !errors.Is(err, ErrBinaryNotFound) {
+		t.Errorf("Error: expected ErrBinaryNotFound, got %v", err)
+	}
+
+	_, err = (&LPass{Username: "me@some.where"}).Login([]string{})
+	if !errors.Is(err, ErrBinaryNotFound) {
+		t.Errorf("Error: expected Login to return ErrBinaryNotFound, got %v", err)
+	}
+}
+
+func TestFetchUnknownEntry(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	_, err := lpass.Fetch([]string{"no-such-entry"})
+	if !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Error: expected ErrEntryNotFound, got %v", err)
+	}
+}
+
+func TestExitCodeFor(t *testing.T) {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{nil, ExitCodeOk},
+		{fmt.Errorf("something else"), ExitCodeError},
+		{fmt.Errorf("wrapped: %w", ErrNotLoggedIn), ExitCodeNotLoggedIn},
+		{ErrBinaryNotFound, ExitCodeBinaryNotFound},
+		{ErrEntryNotFound, ExitCodeEntryNotFound},
+		{&ParseError{Line: 1}, ExitCodeParseError},
+		{&CacheError{Op: "read"}, ExitCodeCacheError},
+	}
+
+	for _, c := range cases {
+		if code := ExitCodeFor(c.err); code != c.code {
+			t.Errorf("Error: expected ExitCodeFor(%v) to be %d, got %d", c.err, c.code, code)
+		}
+	}
+}
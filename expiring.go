@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var withinRegexp = regexp.MustCompile(`^(\d+)([dwy])$`)
+
+// ParseWithin takes a number of days, weeks or years (30d, 2w, 1y) or
+// anything time.ParseDuration does (12h)
+func ParseWithin(s string) (time.Duration, error) {
+	m := withinRegexp.FindStringSubmatch(s)
+	if m == nil {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("Error: --within expects eg: 30d, 2w, 1y or 12h, got '%s'", s)
+		}
+		return d, nil
+	}
+
+	n, _ := strconv.Atoi(m[1])
+	days := map[string]int{"d": 1, "w": 7, "y": 365}[m[2]]
+	return time.Duration(n*days) * 24 * time.Hour, nil
+}
+
+type ExpiringCredential struct {
+	Id        string    `json:"id"`
+	Path      string    `json:"path"`
+	Owner     string    `json:"owner"`
+	ExpiresAt Timestamp `json:"expires-at"`
+	// Days until it expires, negative once it has
+	Days    int  `json:"days"`
+	Expired bool `json:"expired"`
+	expires time.Time
+}
+
+// FindExpiring returns the notes whose ExpiresAt is before now+within,
+// including the ones that have already expired, soonest first
+func FindExpiring(notes []*LPassSecureNote, now time.Time, within time.Duration) ([]*ExpiringCredential, []error) {
+	found := make([]*ExpiringCredential, 0)
+	var errs []error
+
+	for _, note := range notes {
+		if note.Credential == nil || note.Credential.ExpiresAt.IsZero() {
+			continue
+		}
+
+		expires, err := note.Credential.ExpiresAt.Time()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: ExpiresAt %w", note.EntryInfo.AccountNameIncludingPath, err))
+			continue
+		}
+
+		if expires.After(now.Add(within)) {
+			continue
+		}
+
+		found = append(found, &ExpiringCredential{
+			Id:        note.EntryInfo.AccountId,
+			Path:      note.EntryInfo.AccountNameIncludingPath,
+			Owner:     note.Credential.Owner,
+			ExpiresAt: note.Credential.ExpiresAt,
+			Days:      int(math.Floor(expires.Sub(now).Hours() / 24)),
+			Expired:   !expires.After(now),
+			expires:   expires,
+		})
+	}
+
+	SortExpiring(found, "date")
+	return found, errs
+}
+
+// SortExpiring orders by "date" (then path) or "owner" (then date)
+func SortExpiring(creds []*ExpiringCredential, by string) {
+	sort.SliceStable(creds, func(ii, jj int) bool {
+		a, b := creds[ii], creds[jj]
+		if by == "owner" && a.Owner != b.Owner {
+			return a.Owner < b.Owner
+		}
+		if !a.expires.Equal(b.expires) {
+			return a.expires.Before(b.expires)
+		}
+		return a.Path < b.Path
+	})
+}
+
+type ExpiringOptions struct {
+	Within string
+	Sort   string
+	Format string
+	// Now is when the report is for, the zero value is time.Now()
+	Now time.Time
+}
+
+func printExpiring(creds []*ExpiringCredential, format string) error {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(creds, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"id", "path", "owner", "expires-at", "days", "expired"})
+		for _, c := range creds {
+			w.Write([]string{c.Id, c.Path, c.Owner, string(c.ExpiresAt), strconv.Itoa(c.Days), strconv.FormatBool(c.Expired)})
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		for _, c := range creds {
+			status := "expiring"
+			if c.Expired {
+				status = "expired"
+			}
+			fmt.Printf("%-8s  %-20s  %5dd  %-12s  %s\n", status, c.ExpiresAt, c.Days, c.Owner, c.Path)
+		}
+	}
+
+	return nil
+}
+
+// Expiring reports the credentials that expire within opts.Within, it
+// returns an ExpiredError if any already have so CI can fail the build
+func (self *LPass) Expiring(args []string, opts ExpiringOptions) (*exec.Cmd, error) {
+	within, err := ParseWithin(opts.Within)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Sort != "date" && opts.Sort != "owner" {
+		return nil, fmt.Errorf("Error: --sort expects date or owner, got '%s'", opts.Sort)
+	}
+
+	if opts.Format != "text" && opts.Format != "json" && opts.Format != "csv" {
+		return nil, fmt.Errorf("Error: --format expects text, json or csv, got '%s'", opts.Format)
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	entries, err := self.GetList(args)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]*LPassSecureNote, 0)
+	fetched, fetchErrs := self.FetchSecureNotes(entries, 4)
+	var errs []error
+	for ii, entry := range entries {
+		if fetchErrs[ii] != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.AccountNameIncludingPath, fetchErrs[ii]))
+			continue
+		}
+		notes = append(notes, fetched[ii])
+	}
+
+	creds, parseErrs := FindExpiring(notes, now, within)
+	errs = append(errs, parseErrs...)
+	SortExpiring(creds, opts.Sort)
+
+	err = printExpiring(creds, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := 0
+	for _, c := range creds {
+		if c.Expired {
+			expired++
+		}
+	}
+
+	// NB: the summary goes to stderr so the json and csv stay parseable
+	fmt.Fprintf(os.Stderr, "%d expired, %d expiring within %s, %d errors\n", expired, len(creds)-expired, opts.Within, len(errs))
+
+	if expired > 0 {
+		errs = append(errs, &ExpiredError{Count: expired})
+	}
+
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWithin(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"1y":  365 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+	} {
+		d, err := ParseWithin(s)
+		if err != nil || d != expected {
+			t.Errorf("Error: expected %s to be %s, got %s / %v", s, expected, d, err)
+		}
+	}
+
+	if _, err := ParseWithin("soon"); err == nil {
+		t.Errorf("Error: expected 'soon' to be rejected")
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	for ts, expected := range map[Timestamp]string{
+		"2025-01-31":           "2025-01-31T00:00:00Z",
+		"2025-01-31T10:00:00Z": "2025-01-31T10:00:00Z",
+		"2025-01-31 10:00":     "2025-01-31T10:00:00Z",
+		"June,2027":            "2027-06-30T00:00:00Z",
+	} {
+		tm, err := ts.Time()
+		if err != nil || tm.Format(time.RFC3339) != expected {
+			t.Errorf("Error: expected %s to be %s, got %s / %v", ts, expected, tm, err)
+		}
+	}
+
+	if _, err := Timestamp("next tuesday").Time(); err == nil {
+		t.Errorf("Error: expected 'next tuesday' not to parse")
+	}
+}
+
+func expiringFakeLPass(t *testing.T) *LPass {
+	lpass, fake := newFakeLPass(t, "basic")
+	fake.Find("deploy-key").Set("Notes", `{"Name": "deploy-key", "Owner": "infra", "ExpiresAt": "2025-03-01"}`)
+	fake.Find("Test Note for Notes").Set("Notes", `{"Name": "Test Note for Notes", "Owner": "platform", "ExpiresAt": "2025-01-10"}`)
+	return lpass
+}
+
+var expiringNow = time.Date(2025, 2, 15, 12, 0, 0, 0, time.UTC)
+
+func TestExpiringReport(t *testing.T) {
+	lpass := expiringFakeLPass(t)
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Expiring([]string{}, ExpiringOptions{Within: "30d", Sort: "date", Format: "text", Now: expiringNow})
+	})
+
+	if ExitCodeFor(err) != ExitCodeExpired {
+		t.Errorf("Error: expected the expired exit code, got %d / %v", ExitCodeFor(err), err)
+	}
+
+	expected := "expired   2025-01-10              -37d  platform      Test/Test Note for Notes\n" +
+		"expiring  2025-03-01               13d  infra         Shared-Infra/aws/deploy-key\n"
+	if output != expected {
+		t.Errorf("Error: expected:\n%s\ngot:\n%s", expected, output)
+	}
+
+	output = captureStdout(t, func() {
+		_, err = lpass.Expiring([]string{}, ExpiringOptions{Within: "30d", Sort: "owner", Format: "csv", Now: expiringNow})
+	})
+
+	rows, _ := csv.NewReader(strings.NewReader(output)).ReadAll()
+	if len(rows) != 3 || rows[1][1] != "Shared-Infra/aws/deploy-key" || rows[2][5] != "true" {
+		t.Errorf("Error: expected csv sorted by owner, got %q", rows)
+	}
+}
+
+func TestExpiringJsonWithin(t *testing.T) {
+	lpass := expiringFakeLPass(t)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Expiring([]string{}, ExpiringOptions{Within: "2w", Sort: "date", Format: "json", Now: now})
+	})
+	if err != nil {
+		t.Fatalf("Error: expected nothing to have expired, got %v", err)
+	}
+
+	var creds []*ExpiringCredential
+	err = json.Unmarshal([]byte(output), &creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(creds) != 1 || creds[0].Owner != "platform" || creds[0].Days != 9 || creds[0].Expired {
+		t.Errorf("Error: expected only the note expiring in 9 days, got %s", output)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FakeBackend is an in-memory Backend serving a vault loaded from a
+// directory of `lpass show --color=never --all` fixture files (*.out).
+type FakeBackend struct {
+	Username  string
+	LoggedIn  bool
+	Entries   []*FakeEntry
+	Mutations []FakeMutation
+	// ShowErrors makes Show fail for the given ids
+	ShowErrors map[string]error
+	// RemoveErrors makes Remove fail for the given ids
+	RemoveErrors map[string]error
+	nextId       int
+	clock        int64
+}
+
+type FakeEntry struct {
+	Id               string
+	Path             string
+	Share            string
+	Group            string
+	ModificationTime string
+	LastTouchTime    string
+	Fields           []*FakeField
+}
+
+type FakeField struct {
+	Name  string
+	Value string
+}
+
+type FakeMutation struct {
+	Op    string
+	Id    string
+	Field string
+	Value string
+}
+
+var fakeFieldLineRegexp = regexp.MustCompile(`^([A-Za-z0-9 _\-]+): ?(.*)$`)
+
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{
+		Username: "me@some.where",
+		LoggedIn: true,
+		Entries:  make([]*FakeEntry, 0),
+		nextId:   9000000000000000001,
+		clock:    1600000000,
+	}
+}
+
+// Touch bumps the entry's modification time, as lastpass does on every change
+func (self *FakeBackend) Touch(ent *FakeEntry) {
+	self.clock++
+	ent.ModificationTime = fmt.Sprintf("%d", self.clock)
+	ent.LastTouchTime = ent.ModificationTime
+}
+
+func LoadFakeBackend(dname string) (*FakeBackend, error) {
+	fake := NewFakeBackend()
+
+	files, err := filepath.Glob(filepath.Join(dname, "*.out"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	for _, fname := range files {
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+
+		ent, err := ParseFakeEntry(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("LoadFakeBackend: %s: %s", fname, err)
+		}
+		fake.Touch(ent)
+		fake.Entries = append(fake.Entries, ent)
+	}
+
+	return fake, nil
+}
+
+// ParseFakeEntry is deliberately simpler than ParseShow: the fake has to
+// be able to serve whatever a fixture contains, even what ParseShow rejects
+func ParseFakeEntry(s string) (*FakeEntry, error) {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	spos := strings.LastIndex(lines[0], " [id: ")
+	if spos == -1 || !strings.HasSuffix(lines[0], "]") {
+		return nil, fmt.Errorf("expected '<path> [id: <id>]' on the first line, got '%s'", lines[0])
+	}
+
+	ent := &FakeEntry{
+		Path: lines[0][0:spos],
+		Id:   strings.TrimSuffix(lines[0][spos+len(" [id: "):], "]"),
+	}
+	ent.Fields = parseFakeFields(lines[1:])
+
+	if strings.HasPrefix(ent.Path, "Shared-") {
+		ent.Share = strings.SplitN(ent.Path, "/", 2)[0]
+	}
+
+	return ent, nil
+}
+
+func parseFakeFields(lines []string) []*FakeField {
+	fields := make([]*FakeField, 0)
+	var last *FakeField
+
+	for ii, line := range lines {
+		m := fakeFieldLineRegexp.FindStringSubmatch(line)
+		if m == nil && last != nil {
+			last.Value = last.Value + "\n" + line
+			continue
+		}
+
+		if m == nil {
+			continue
+		}
+
+		if m[1] == "Notes" {
+			fields = append(fields, &FakeField{
+				Name:  "Notes",
+				Value: strings.TrimLeft(strings.Join(append([]string{m[2]}, lines[ii+1:]...), "\n"), "\n"),
+			})
+			break
+		}
+
+		last = &FakeField{Name: m[1], Value: m[2]}
+		fields = append(fields, last)
+	}
+
+	return fields
+}
+
+func (self *FakeEntry) Name() string {
+	return self.Path[strings.LastIndex(self.Path, "/")+1:]
+}
+
+func (self *FakeEntry) Get(name string) string {
+	for _, field := range self.Fields {
+		if field.Name == name {
+			return field.Value
+		}
+	}
+
+	return ""
+}
+
+func (self *FakeEntry) Set(name, value string) {
+	for _, field := range self.Fields {
+		if field.Name == name {
+			field.Value = value
+			return
+		}
+	}
+
+	field := &FakeField{Name: name, Value: value}
+
+	// NB: keep Notes last, the same as lpass does
+	if len(self.Fields) > 0 && self.Fields[len(self.Fields)-1].Name == "Notes" {
+		notes := self.Fields[len(self.Fields)-1]
+		self.Fields = append(self.Fields[:len(self.Fields)-1], field, notes)
+		return
+	}
+
+	self.Fields = append(self.Fields, field)
+}
+
+func (self *FakeEntry) ToShowOutput() string {
+	lines := []string{fmt.Sprintf("%s [id: %s]", self.Path, self.Id)}
+
+	for _, field := range self.Fields {
+		lines = append(lines, field.Name+": "+field.Value)
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func (self *FakeEntry) formatCode(code string) string {
+	switch code {
+	case "ai":
+		return self.Id
+	case "an":
+		return self.Name()
+	case "aN":
+		return self.Path
+	case "au":
+		return self.Get("Username")
+	case "ap":
+		return self.Get("Password")
+	case "am":
+		return self.ModificationTime
+	case "aU":
+		return self.LastTouchTime
+	case "as":
+		return self.Share
+	case "ag":
+		return self.Group
+	}
+
+	return ""
+}
+
+// Format renders the entry the way `lpass ls --format=<format>` does,
+// including the %/xx form that appends a '/' to non-empty values
+func (self *FakeEntry) Format(format string) string {
+	var buf strings.Builder
+
+	for ii := 0; ii < len(format); ii++ {
+		if format[ii] != '%' {
+			buf.WriteByte(format[ii])
+			continue
+		}
+
+		jj := ii + 1
+		slash := false
+		if jj < len(format) && format[jj] == '/' {
+			slash = true
+			jj++
+		}
+
+		if jj+2 > len(format) {
+			buf.WriteString(format[ii:])
+			break
+		}
+
+		val := self.formatCode(format[jj : jj+2])
+		buf.WriteString(val)
+		if slash && val != "" {
+			buf.WriteString("/")
+		}
+		ii = jj + 1
+	}
+
+	return buf.String()
+}
+
+func (self *FakeBackend) Find(id_or_name string) *FakeEntry {
+	for _, ent := range self.Entries {
+		if ent.Id == id_or_name || ent.Path == id_or_name || ent.Name() == id_or_name {
+			return ent
+		}
+	}
+
+	return nil
+}
+
+func (self *FakeBackend) notLoggedIn() error {
+	return ErrNotLoggedIn
+}
+
+func (self *FakeBackend) notFound() error {
+	return ErrEntryNotFound
+}
+
+func (self *FakeBackend) List(format string) (string, error) {
+	if !self.LoggedIn {
+		return "", self.notLoggedIn()
+	}
+
+	lines := make([]string, 0)
+	for _, ent := range self.Entries {
+		lines = append(lines, ent.Format(format)+"\n")
+	}
+
+	return strings.Join(lines, ""), nil
+}
+
+func (self *FakeBackend) Show(id_or_name string) (string, error) {
+	if !self.LoggedIn {
+		return "", self.notLoggedIn()
+	}
+
+	ent := self.Find(id_or_name)
+	if ent == nil {
+		return "", self.notFound()
+	}
+
+	if err, ok := self.ShowErrors[ent.Id]; ok {
+		return "", err
+	}
+
+	return ent.ToShowOutput(), nil
+}
+
+func (self *FakeBackend) Add(name string, noteType string, data string) (string, error) {
+	if !self.LoggedIn {
+		return "", self.notLoggedIn()
+	}
+
+	ent := &FakeEntry{
+		Id:     fmt.Sprintf("%d", self.nextId),
+		Path:   name,
+		Fields: parseFakeFields(strings.Split(strings.TrimRight(data, "\n"), "\n")),
+	}
+	self.nextId++
+	self.Touch(ent)
+
+	if noteType != "" {
+		nt := LookupNoteType(noteType)
+		if nt == nil {
+			return "", fmt.Errorf("Error: unknown note type %s", noteType)
+		}
+		ent.Fields = append([]*FakeField{{Name: "NoteType", Value: nt.Name}}, ent.Fields...)
+	}
+
+	if !strings.Contains(ent.Path, "/") {
+		ent.Path = "(none)/" + ent.Path
+	}
+
+	self.Entries = append(self.Entries, ent)
+	self.Mutations = append(self.Mutations, FakeMutation{Op: "add", Id: ent.Id, Field: name, Value: data})
+
+	return ent.Id, nil
+}
+
+func (self *FakeBackend) Edit(id_or_name string, field string, value string) error {
+	if !self.LoggedIn {
+		return self.notLoggedIn()
+	}
+
+	ent := self.Find(id_or_name)
+	if ent == nil {
+		return self.notFound()
+	}
+
+	if field == "Name" {
+		ent.Path = value
+	} else {
+		ent.Set(field, value)
+	}
+	self.Touch(ent)
+	self.Mutations = append(self.Mutations, FakeMutation{Op: "edit", Id: ent.Id, Field: field, Value: value})
+
+	return nil
+}
+
+func (self *FakeBackend) Remove(id_or_name string) error {
+	if !self.LoggedIn {
+		return self.notLoggedIn()
+	}
+
+	target := self.Find(id_or_name)
+	if target != nil {
+		if err, ok := self.RemoveErrors[target.Id]; ok {
+			return err
+		}
+	}
+
+	for idx, ent := range self.Entries {
+		if ent == target {
+			self.Entries = append(self.Entries[:idx], self.Entries[idx+1:]...)
+			self.Mutations = append(self.Mutations, FakeMutation{Op: "rm", Id: ent.Id})
+			return nil
+		}
+	}
+
+	return self.notFound()
+}
+
+func (self *FakeBackend) Sync() error {
+	if !self.LoggedIn {
+		return self.notLoggedIn()
+	}
+
+	self.Mutations = append(self.Mutations, FakeMutation{Op: "sync"})
+	return nil
+}
+
+func (self *FakeBackend) Status() (string, error) {
+	if !self.LoggedIn {
+		return "Not logged in.", ErrNotLoggedIn
+	}
+
+	return fmt.Sprintf("Logged in as %s.", self.Username), nil
+}
+
+func (self *FakeBackend) Login(username string) error {
+	self.LoggedIn = true
+	self.Username = username
+	return nil
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The test binary doubles as a fake lpass: installFakeLPass symlinks it
+// into a temp dir as `lpass` and puts that dir first on the PATH, so the
+// real LPassCli code path runs against a fixture vault.
+//
+//	FAKE_LPASS_VAULT  the fixture vault directory (see LoadFakeBackend)
+//	FAKE_LPASS_STATE  scratch directory, holds the login session and a
+//	                  log of every invocation
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == "lpass" {
+		os.Exit(fakeLPassMain(os.Args[1:]))
+	}
+
+	if uname := os.Getenv("RLPASS_TEST_LOGIN_AS"); uname != "" {
+		lpass := &LPass{Username: uname}
+		lpass.Login([]string{})
+		// NB: Login only returns if the exec failed
+		os.Exit(99)
+	}
+
+	os.Exit(m.Run())
+}
+
+func fakeLPassMain(args []string) int {
+	stateDir := os.Getenv("FAKE_LPASS_STATE")
+	sessionFile := filepath.Join(stateDir, "session")
+
+	f, err := os.OpenFile(filepath.Join(stateDir, "commands.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err == nil {
+		fmt.Fprintf(f, "%q\n", args)
+		f.Close()
+	}
+
+	fake, err := LoadFakeBackend(os.Getenv("FAKE_LPASS_VAULT"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fake lpass: %s\n", err)
+		return 2
+	}
+
+	// NB: each invocation is a new process, entries added by earlier ones
+	// are kept in the state dir
+	added, err := LoadFakeBackend(stateDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fake lpass: %s\n", err)
+		return 2
+	}
+	fake.Entries = append(fake.Entries, added.Entries...)
+	fake.nextId += len(added.Entries)
+
+	session, err := ioutil.ReadFile(sessionFile)
+	fake.LoggedIn = err == nil
+	if fake.LoggedIn {
+		fake.Username = string(session)
+	}
+
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: lpass {--help|--version}\n")
+		return 1
+	}
+
+	cmd, flags, positional := args[0], map[string]string{}, []string{}
+	for _, arg := range args[1:] {
+		if !strings.HasPrefix(arg, "--") {
+			positional = append(positional, arg)
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)
+		kv = append(kv, "")
+		flags[kv[0]] = kv[1]
+	}
+
+	fail := func(err error) int {
+		switch {
+		case errors.Is(err, ErrNotLoggedIn):
+			fmt.Fprintf(os.Stderr, "Error: Could not find decryption key. Perhaps you need to login with `lpass login`.\n")
+		case errors.Is(err, ErrEntryNotFound):
+			fmt.Fprintf(os.Stderr, "Error: Could not find specified account(s).\n")
+		default:
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+		return 1
+	}
+
+	switch cmd {
+	case "--version":
+		fmt.Printf("LastPass CLI v1.1.2\n")
+		return 0
+	case "login":
+		if _, ok := flags["trust"]; !ok || len(positional) != 1 {
+			return fail(fmt.Errorf("Usage: lpass login [--trust] USERNAME"))
+		}
+		err = ioutil.WriteFile(sessionFile, []byte(positional[0]), 0600)
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Printf("Success: Logged in as %s.\n", positional[0])
+		return 0
+	case "status":
+		output, err := fake.Status()
+		fmt.Printf("%s\n", output)
+		if err != nil {
+			return 1
+		}
+		return 0
+	case "sync":
+		err = fake.Sync()
+		if err != nil {
+			return fail(err)
+		}
+		return 0
+	case "ls":
+		output, err := fake.List(flags["format"])
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Print(output)
+		return 0
+	case "add":
+		if len(positional) != 1 {
+			return fail(fmt.Errorf("Usage: lpass add [--non-interactive] [--note-type=TYPE] {NAME|UNIQUEID}"))
+		}
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return fail(err)
+		}
+		id, err := fake.Add(positional[0], flags["note-type"], string(data))
+		if err != nil {
+			return fail(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(stateDir, "added-"+id+".out"), []byte(fake.Find(id).ToShowOutput()), 0600)
+		if err != nil {
+			return fail(err)
+		}
+		return 0
+	case "show":
+		if len(positional) != 1 {
+			return fail(fmt.Errorf("Usage: lpass show [--all] {UNIQUENAME|UNIQUEID}"))
+		}
+		output, err := fake.Show(positional[0])
+		if err != nil {
+			return fail(err)
+		}
+		if _, ok := flags["id"]; ok {
+			fmt.Printf("%s\n", fake.Find(positional[0]).Id)
+			return 0
+		}
+		fmt.Print(output)
+		return 0
+	}
+
+	return fail(fmt.Errorf("fake lpass: unsupported command '%s'", cmd))
+}
+
+func installFakeLPass(t *testing.T, vault string, loggedInAs string) string {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binDir := t.TempDir()
+	stateDir := t.TempDir()
+
+	err = os.Symlink(self, filepath.Join(binDir, "lpass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loggedInAs != "" {
+		err = ioutil.WriteFile(filepath.Join(stateDir, "session"), []byte(loggedInAs), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_LPASS_VAULT", filepath.Join("fixtures", "vaults", vault))
+	t.Setenv("FAKE_LPASS_STATE", stateDir)
+
+	return stateDir
+}
+
+func newCliLPass(t *testing.T) *LPass {
+	tmpdir := t.TempDir()
+	lpass := &LPass{
+		Username:          "me@some.where",
+		Cachedir:          filepath.Join(tmpdir, "cache"),
+		CredentialsFolder: filepath.Join(tmpdir, "credentials"),
+		Backend:           NewLPassCli(),
+	}
+
+	err := os.MkdirAll(lpass.Cachedir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return lpass
+}
+
+func TestLPassCliGetList(t *testing.T) {
+	stateDir := installFakeLPass(t, "basic", "me@some.where")
+	lpass := newCliLPass(t)
+
+	entries, err := lpass.GetList([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("Error: expected 3 entries from the fake lpass, got %d", len(entries))
+	}
+
+	log, err := ioutil.ReadFile(filepath.Join(stateDir, "commands.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(log), `["ls" "--format=`) {
+		t.Errorf("Error: expected GetList to run `lpass ls --format=...`, got %s", log)
+	}
+}
+
+func TestLPassCliGetSecureNote(t *testing.T) {
+	installFakeLPass(t, "basic", "me@some.where")
+	lpass := newCliLPass(t)
+
+	note, err := lpass.GetSecureNote("tivo.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if note.EntryInfo.AccountId != "5926414273882541009" {
+		t.Errorf("Error: expected AccountId=5926414273882541009, got '%s'", note.EntryInfo.AccountId)
+	}
+}
+
+func TestLPassCliStatus(t *testing.T) {
+	installFakeLPass(t, "basic", "me@some.where")
+
+	status, err := NewLPassCli().Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != "Logged in as me@some.where." {
+		t.Errorf("Error: unexpected status '%s'", status)
+	}
+}
+
+func TestLPassCliNotLoggedIn(t *testing.T) {
+	installFakeLPass(t, "basic", "")
+	lpass := newCliLPass(t)
+
+	status, err := lpass.backend().Status()
+	if err == nil || status != "Not logged in." {
+		t.Errorf("Error: expected status to fail with 'Not logged in.', got '%s' / %v", status, err)
+	}
+
+	var lpassErr *LPassError
+	if !errors.As(err, &lpassErr) || lpassErr.ExitCode != 1 || !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("Error: expected lpass status to exit 1 with ErrNotLoggedIn, got %v", err)
+	}
+
+	_, err = lpass.GetList([]string{})
+	if !errors.As(err, &lpassErr) || !errors.Is(err, ErrNotLoggedIn) {
+		t.Fatalf("Error: expected GetList to fail with ErrNotLoggedIn, got %v", err)
+	}
+
+	if !strings.Contains(lpassErr.Stderr, "Could not find decryption key") {
+		t.Errorf("Error: expected lpass's stderr on the error, got '%s'", lpassErr.Stderr)
+	}
+
+	// NB: the error output must not be parsed or cached as if it were a listing
+	if FileExists(filepath.Join(lpass.Cachedir, listCacheKey)) {
+		t.Error("Error: expected GetList not to cache a failed listing")
+	}
+}
+
+func TestLPassCliShowUnknownEntry(t *testing.T) {
+	installFakeLPass(t, "basic", "me@some.where")
+	lpass := newCliLPass(t)
+
+	_, err := lpass.GetSecureNote("no-such-entry")
+	if !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Error: expected ErrEntryNotFound, got %v", err)
+	}
+
+	if ExitCodeFor(err) != ExitCodeEntryNotFound {
+		t.Errorf("Error: expected exit code %d, got %d", ExitCodeEntryNotFound, ExitCodeFor(err))
+	}
+}
+
+func TestLPassLoginExecsLPass(t *testing.T) {
+	stateDir := installFakeLPass(t, "basic", "")
+
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "RLPASS_TEST_LOGIN_AS=someone@some.where")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Error: expected login to exit 0, got %s\n%s", err, output)
+	}
+
+	if !strings.Contains(string(output), "Success: Logged in as someone@some.where.") {
+		t.Errorf("Error: expected Login to exec `lpass login`, got:\n%s", output)
+	}
+
+	session, err := ioutil.ReadFile(filepath.Join(stateDir, "session"))
+	if err != nil || string(session) != "someone@some.where" {
+		t.Errorf("Error: expected a session for someone@some.where, got '%s' / %v", session, err)
+	}
+
+	status, err := NewLPassCli().Status()
+	if err != nil || status != "Logged in as someone@some.where." {
+		t.Errorf("Error: expected to be logged in after Login, got '%s' / %v", status, err)
+	}
+}
+
+func TestLPassCliAddReturnsTheNewId(t *testing.T) {
+	installFakeLPass(t, "basic", "me@some.where")
+	cli := NewLPassCli()
+
+	// NB: there's already a deploy-key, `lpass show --id deploy-key` would be ambiguous
+	id, err := cli.Add("Shared-Infra/aws/deploy-key", "", "Notes: {}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id == "" || id == "3172274455914884164282" {
+		t.Errorf("Error: expected the id of the new deploy-key, got '%s'", id)
+	}
+
+	output, err := cli.Show(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output, "[id: "+id+"]") {
+		t.Errorf("Error: expected to be able to show the new entry, got:\n%s", output)
+	}
+}
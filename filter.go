@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// NamePattern is either a glob (see LPassEntry.Matches) or a /regex/
+// matched against the entry's full name
+type NamePattern struct {
+	Pattern string
+	Regexp  *regexp.Regexp
+}
+
+func ParseNamePattern(pattern string) (*NamePattern, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("Error: invalid regex '%s': %s", pattern, err)
+		}
+		return &NamePattern{Pattern: pattern, Regexp: re}, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("Error: invalid pattern '%s': %s", pattern, err)
+	}
+
+	return &NamePattern{Pattern: pattern}, nil
+}
+
+func (self *NamePattern) Matches(entry *LPassEntry) bool {
+	if self.Regexp != nil {
+		return self.Regexp.MatchString(entry.AccountNameIncludingPath)
+	}
+
+	return entry.Matches(self.Pattern)
+}
+
+// ListFilter restricts the entries returned by GetList.  Each kind of
+// filter matches if any of its values match, an entry has to match every
+// kind of filter that was given and none of the Excludes.
+type ListFilter struct {
+	Folders  []string
+	Shares   []string
+	Groups   []string
+	Names    []*NamePattern
+	Excludes []*NamePattern
+}
+
+func NewListFilter(folders, shares, groups, names, excludes []string) (*ListFilter, error) {
+	filter := &ListFilter{Folders: folders, Shares: shares, Groups: groups}
+
+	for _, name := range names {
+		pattern, err := ParseNamePattern(name)
+		if err != nil {
+			return nil, err
+		}
+		filter.Names = append(filter.Names, pattern)
+	}
+
+	for _, name := range excludes {
+		pattern, err := ParseNamePattern(name)
+		if err != nil {
+			return nil, err
+		}
+		filter.Excludes = append(filter.Excludes, pattern)
+	}
+
+	return filter, nil
+}
+
+func inFolder(entry *LPassEntry, folder string) bool {
+	folder = strings.Trim(folder, "/")
+	return strings.HasPrefix(entry.AccountNameIncludingPath, folder+"/")
+}
+
+func matchesAny(entry *LPassEntry, patterns []*NamePattern) bool {
+	for _, pattern := range patterns {
+		if pattern.Matches(entry) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self *ListFilter) Matches(entry *LPassEntry) bool {
+	if self == nil {
+		return true
+	}
+
+	if len(self.Folders) > 0 {
+		found := false
+		for _, folder := range self.Folders {
+			found = found || inFolder(entry, folder)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(self.Shares) > 0 && !containsString(self.Shares, entry.AccountShareName) {
+		return false
+	}
+
+	if len(self.Groups) > 0 && !containsString(self.Groups, entry.AccountGroupName) {
+		return false
+	}
+
+	if len(self.Names) > 0 && !matchesAny(entry, self.Names) {
+		return false
+	}
+
+	return !matchesAny(entry, self.Excludes)
+}
+
+func (self *ListFilter) Apply(entries []*LPassEntry) []*LPassEntry {
+	if self == nil {
+		return entries
+	}
+
+	matches := make([]*LPassEntry, 0)
+	for _, entry := range entries {
+		if self.Matches(entry) {
+			matches = append(matches, entry)
+		}
+	}
+
+	return matches
+}
+
+func containsString(vals []string, s string) bool {
+	for _, val := range vals {
+		if val == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+var listFilterFlags = []cli.Flag{
+	cli.StringSliceFlag{
+		Name:  "folder",
+		Usage: "Only entries in this folder (and its sub-folders), eg: Shared-Infra/",
+	},
+	cli.StringSliceFlag{
+		Name:  "share",
+		Usage: "Only entries in this shared folder",
+	},
+	cli.StringSliceFlag{
+		Name:  "group",
+		Usage: "Only entries in this group",
+	},
+	cli.StringSliceFlag{
+		Name:  "name",
+		Usage: "Only entries whose name matches this glob or /regex/",
+	},
+	cli.StringSliceFlag{
+		Name:  "exclude",
+		Usage: "Skip entries whose name matches this glob or /regex/",
+	},
+}
+
+func listFilterFromContext(c *cli.Context) (*ListFilter, error) {
+	return NewListFilter(c.StringSlice("folder"), c.StringSlice("share"), c.StringSlice("group"), c.StringSlice("name"), c.StringSlice("exclude"))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListFilter(t *testing.T) {
+	entries := []*LPassEntry{
+		{AccountId: "1", AccountName: "deploy-key", AccountNameIncludingPath: "Shared-Infra/aws/deploy-key", AccountShareName: "Shared-Infra"},
+		{AccountId: "2", AccountName: "reporting", AccountNameIncludingPath: "Shared-Infra/db/reporting", AccountShareName: "Shared-Infra"},
+		{AccountId: "3", AccountName: "tivo.com", AccountNameIncludingPath: "(none)/tivo.com"},
+		{AccountId: "4", AccountName: "Test Note", AccountNameIncludingPath: "Test/Test Note", AccountGroupName: "Test"},
+	}
+
+	for _, tc := range []struct {
+		folders  []string
+		shares   []string
+		groups   []string
+		names    []string
+		excludes []string
+		expected string
+	}{
+		{expected: "1,2,3,4"},
+		{folders: []string{"Shared-Infra/"}, expected: "1,2"},
+		{folders: []string{"Shared-Infra/aws", "Test"}, expected: "1,4"},
+		{shares: []string{"Shared-Infra"}, expected: "1,2"},
+		{groups: []string{"Test"}, expected: "4"},
+		{names: []string{"*.com"}, expected: "3"},
+		{names: []string{"/^Shared-.*/(aws|db)/r/"}, expected: "2"},
+		{shares: []string{"Shared-Infra"}, excludes: []string{"*/db/*"}, expected: "1"},
+		{excludes: []string{"/Test/"}, expected: "1,2,3"},
+	} {
+		filter, err := NewListFilter(tc.folders, tc.shares, tc.groups, tc.names, tc.excludes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := make([]string, 0)
+		for _, entry := range filter.Apply(entries) {
+			ids = append(ids, entry.AccountId)
+		}
+
+		if strings.Join(ids, ",") != tc.expected {
+			t.Errorf("Error: expected %+v to match %s, got %s", tc, tc.expected, strings.Join(ids, ","))
+		}
+	}
+}
+
+func TestListFilterInvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{"/[a-/", "[a-"} {
+		_, err := NewListFilter(nil, nil, nil, []string{pattern}, nil)
+		if err == nil {
+			t.Errorf("Error: expected '%s' to be rejected", pattern)
+		}
+	}
+}
+
+func TestSyncToLocalFiltered(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	captureStdout(t, func() {
+		_, err := lpass.SyncToLocal([]string{}, SyncDownOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	filter, err := NewListFilter([]string{"Shared-Infra/"}, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lpass.Filter = filter
+
+	output := captureStdout(t, func() {
+		_, err = lpass.SyncToLocal([]string{}, SyncDownOptions{Prune: true})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NB: filtered out entries are still in lastpass, so --prune leaves them alone
+	if !strings.Contains(output, "0 removed, 1 unchanged") {
+		t.Errorf("Error: expected only Shared-Infra to be considered, got:\n%s", output)
+	}
+
+	if !FileExists(filepath.Join(lpass.CredentialsFolder, "-none-", "tivo.com", "credential.json")) {
+		t.Errorf("Error: expected --prune not to remove filtered out entries")
+	}
+
+	entries, err := lpass.GetList([]string{})
+	if err != nil || len(entries) != 1 || entries[0].AccountName != "deploy-key" {
+		t.Errorf("Error: expected GetList to apply the filter, got %+v / %v", entries, err)
+	}
+}
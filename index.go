@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// NB: the index only ever holds non-secret fields (see isPublicField), it's encrypted anyway
+// since names, urls and usernames are still a map of what's in the vault
+const searchIndexKey = "Search.index"
+
+var searchIndexAdditionalData = []byte("rlpass-search-index-v1")
+
+type SearchIndexEntry struct {
+	Entry  *LPassEntry
+	Fields map[string]string
+}
+
+// SearchIndex is the offline copy of the searchable, non-secret fields of
+// every entry written by sync-down, keyed by id
+type SearchIndex struct {
+	Entries map[string]*SearchIndexEntry
+}
+
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{Entries: make(map[string]*SearchIndexEntry)}
+}
+
+func (self *SearchIndex) Has(id string) bool {
+	_, ok := self.Entries[id]
+	return ok
+}
+
+func (self *SearchIndex) Put(entry *LPassEntry, note *LPassSecureNote) {
+	fields := make(map[string]string)
+	for k, v := range note.SearchFields() {
+		if isPublicField(k) {
+			fields[k] = v
+		}
+	}
+
+	info := *entry
+	info.AccountPassword = ""
+	self.Entries[entry.AccountId] = &SearchIndexEntry{Entry: &info, Fields: fields}
+}
+
+func (self *SearchIndex) Remove(id string) {
+	delete(self.Entries, id)
+}
+
+// Ids returns the ids in the index in a stable order
+func (self *SearchIndex) Ids() []string {
+	ids := make([]string, 0, len(self.Entries))
+	for id := range self.Entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// searchIndexEncryptionKey is the sha256 of $RLPASS_INDEX_KEY, or a random
+// key kept in ~/.rlpass/index.key (created on first use)
+func searchIndexEncryptionKey() ([]byte, error) {
+	if passphrase := os.Getenv("RLPASS_INDEX_KEY"); passphrase != "" {
+		key := sha256.Sum256([]byte(passphrase))
+		return key[:], nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	fname := filepath.Join(home, ".rlpass", "index.key")
+	if FileExists(fname) {
+		key, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("%s: expected a 32 byte key, got %d bytes", fname, len(key))
+		}
+		return key, nil
+	}
+
+	key := make([]byte, 32)
+	_, err = io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(fname), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, ioutil.WriteFile(fname, key, 0600)
+}
+
+func searchIndexCipher() (cipher.AEAD, error) {
+	key, err := searchIndexEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (self *SearchIndex) Encrypt() ([]byte, error) {
+	plaintext, err := json.Marshal(self)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := searchIndexCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, searchIndexAdditionalData), nil
+}
+
+func DecryptSearchIndex(data []byte) (*SearchIndex, error) {
+	gcm, err := searchIndexCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("search index is truncated")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], searchIndexAdditionalData)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt the search index (has the key changed?): %s", err)
+	}
+
+	index := NewSearchIndex()
+	err = json.Unmarshal(plaintext, index)
+	if err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// readSearchIndex returns nil if there is no index yet
+func (self *LPass) readSearchIndex() (*SearchIndex, error) {
+	data, found, err := self.cacheGet(searchIndexKey)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	index, err := DecryptSearchIndex(data)
+	if err != nil {
+		return nil, &CacheError{Op: "read", Key: searchIndexKey, Path: filepath.Join(self.Cachedir, searchIndexKey), Err: err}
+	}
+
+	return index, nil
+}
+
+func (self *LPass) writeSearchIndex(index *SearchIndex) error {
+	data, err := index.Encrypt()
+	if err != nil {
+		return &CacheError{Op: "write", Key: searchIndexKey, Path: filepath.Join(self.Cachedir, searchIndexKey), Err: err}
+	}
+
+	return self.cachePut(searchIndexKey, string(data))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSearchIndexEncryption(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("RLPASS_INDEX_KEY", "")
+
+	data, err := ioutil.ReadFile(filepath.Join("fixtures", "vaults", "basic", "deploy-key.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	note, err := ParseShow(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := NewSearchIndex()
+	index.Put(&LPassEntry{AccountId: "3172274455914884164282", AccountPassword: "l0ew0i1fkhxas5s9yf8n8z5v0v2l"}, note)
+
+	data, err = index.Encrypt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, plaintext := range []string{"deploy-key", "infra", "l0ew0i1fkhxas5s9yf8n8z5v0v2l"} {
+		if strings.Contains(string(data), plaintext) {
+			t.Errorf("Error: expected the index to be encrypted, found '%s'", plaintext)
+		}
+	}
+
+	keyfile := filepath.Join(os.Getenv("HOME"), ".rlpass", "index.key")
+	if info, err := os.Stat(keyfile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Error: expected a 0600 key file at %s, got %v / %v", keyfile, info, err)
+	}
+
+	decrypted, err := DecryptSearchIndex(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := json.Marshal(decrypted)
+	if strings.Contains(string(b), "l0ew0i1fkhxas5s9yf8n8z5v0v2l") {
+		t.Errorf("Error: expected the index not to contain secrets, got %s", b)
+	}
+
+	if decrypted.Entries["3172274455914884164282"].Fields["Notes.Owner"] != "infra" {
+		t.Errorf("Error: expected the Owner to be indexed, got %s", b)
+	}
+
+	t.Setenv("RLPASS_INDEX_KEY", "some other key")
+	_, err = DecryptSearchIndex(data)
+	if err == nil {
+		t.Errorf("Error: expected decryption with a different key to fail")
+	}
+}
+
+func TestSearchIndexOnlyKeepsListedFields(t *testing.T) {
+	note, err := ParseShow(`Shared-Infra/api/partner [id: 42]
+API Token: tok-8f2b1c
+Access Key: AKIAEXAMPLE
+URL: https://api.some.where
+Notes: {"Name": "partner", "Owner": "infra", "apikey": "sk-live-123", "Tags": ["api", "partner"]}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := NewSearchIndex()
+	index.Put(&LPassEntry{AccountId: "42"}, note)
+
+	fields := index.Entries["42"].Fields
+	for _, secret := range []string{"tok-8f2b1c", "AKIAEXAMPLE", "sk-live-123"} {
+		for k, v := range fields {
+			if strings.Contains(v, secret) {
+				t.Errorf("Error: expected '%s' not to be indexed, found it in %s", secret, k)
+			}
+		}
+	}
+
+	if fields["URL"] != "https://api.some.where" || fields["Notes.Owner"] != "infra" || fields["Notes.Tags.1"] != "partner" {
+		t.Errorf("Error: expected the URL, Owner and Tags to be indexed, got %+v", fields)
+	}
+}
+
+func TestOfflineSearch(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+
+	var err error
+	_, err = lpass.Search([]string{"owner:infra"}, SearchOptions{Offline: true})
+	if err == nil || !strings.Contains(err.Error(), "run sync-down first") {
+		t.Errorf("Error: expected offline search without an index to fail, got %v", err)
+	}
+
+	captureStdout(t, func() {
+		_, err = lpass.SyncToLocal([]string{}, SyncDownOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ent := fake.Find("deploy-key")
+	ent.Set("Notes", strings.Replace(ent.Get("Notes"), `"Owner": "infra"`, `"Owner": "security"`, 1))
+	fake.Touch(ent)
+
+	search := func(query string) []*SearchResult {
+		output := captureStdout(t, func() {
+			_, err = lpass.Search([]string{query}, SearchOptions{Offline: true})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var results []*SearchResult
+		err = json.Unmarshal([]byte(output), &results)
+		if err != nil {
+			t.Fatalf("Error: expected json output, got %s: %s", err, output)
+		}
+		return results
+	}
+
+	// NB: offline search doesn't see the change until the next sync-down
+	if results := search("owner:infra"); len(results) != 1 {
+		t.Errorf("Error: expected the offline index to find deploy-key, got %+v", results)
+	}
+
+	if results := search("password:l0ew"); len(results) != 0 {
+		t.Errorf("Error: expected the offline index not to have passwords, got %+v", results)
+	}
+
+	captureStdout(t, func() {
+		_, err = lpass.SyncToLocal([]string{}, SyncDownOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results := search("owner:security"); len(results) != 1 || results[0].Path != "Shared-Infra/aws/deploy-key" {
+		t.Errorf("Error: expected the index to be updated by sync-down, got %+v", results)
+	}
+
+	if results := search("owner:infra"); len(results) != 0 {
+		t.Errorf("Error: expected the old Owner to be gone from the index, got %+v", results)
+	}
+}
+
+func TestSyncToLocalRebuildsUnreadableIndex(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	captureStdout(t, func() {
+		lpass.SyncToLocal([]string{}, SyncDownOptions{})
+	})
+
+	t.Setenv("RLPASS_INDEX_KEY", "a new key")
+
+	output := captureStdout(t, func() {
+		_, err := lpass.SyncToLocal([]string{}, SyncDownOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if !strings.Contains(output, "Saving off 3 of 3 entries") {
+		t.Errorf("Error: expected every entry to be re-fetched to rebuild the index, got:\n%s", output)
+	}
+}
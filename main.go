@@ -1,17 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/urfave/cli"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"syscall"
 )
 
@@ -19,39 +24,48 @@ type LPass struct {
 	Username          string
 	CredentialsFolder string
 	Cachedir          string
+	Backend           Backend
+	AutoLogin         bool
+	Stdin             io.Reader
+	Filter            *ListFilter
+	loginLock         sync.Mutex
+	// NB: confirm keeps one reader so answers typed ahead aren't lost
+	stdinLines *bufio.Reader
 }
 
 type LPassEntry struct {
-	AccountId                string `LPassListFormat:"%ai",json:"id"`
-	AccountName              string `LPassListFormat:"%an",json:"name"`
-	AccountNameIncludingPath string `LPassListFormat:"%aN",json:"path"`
-	AccountUser              string `LPassListFormat:"%au",json:"user"`
-	AccountPassword          string `LPassListFormat:"%ap",json:"password"`
-	AccountModificationTime  string `LPassListFormat:"%am",json:"mtime"`
-	AccountLastTouchTime     string `LPassListFormat:"%aU",json:"atime"`
-	AccountShareName         string `LPassListFormat:"%as",json:"share-name"`
-	AccountGroupName         string `LPassListFormat:"%ag",json:"group-name"`
+	AccountId                string `LPassListFormat:"%ai" json:"id"`
+	AccountName              string `LPassListFormat:"%an" json:"name"`
+	AccountNameIncludingPath string `LPassListFormat:"%aN" json:"path"`
+	AccountUser              string `LPassListFormat:"%au" json:"user"`
+	AccountPassword          string `LPassListFormat:"%ap" json:"password"`
+	AccountModificationTime  string `LPassListFormat:"%am" json:"mtime"`
+	AccountLastTouchTime     string `LPassListFormat:"%aU" json:"atime"`
+	AccountShareName         string `LPassListFormat:"%as" json:"share-name"`
+	AccountGroupName         string `LPassListFormat:"%ag" json:"group-name"`
 	// NB: not sure we're going to use these
-	// FieldName                `LPassListFormat:"%fn",json:"field-name"`
-	// FieldValue               `LPassListFormat:"%fv",json:"field-value"`
+	// FieldName  string `LPassListFormat:"%fn" json:"field-name"`
+	// FieldValue string `LPassListFormat:"%fv" json:"field-value"`
 }
 
+// StandardCredential is what the Notes json of every entry should hold, the
+// schema tags drive StandardCredentialSchema (see `rlpass validate`)
 type StandardCredential struct {
-	Name          string
-	Owner         string
+	Name          string `schema:"required"`
+	Owner         string `schema:"required"`
 	Description   string
-	IssuedAt      string
+	IssuedAt      Timestamp `schema:"format=date"`
 	IssuedBy      string
 	IssuedTo      string
-	ExpiresAt     string
-	LastRotatedAt string
+	ExpiresAt     Timestamp `schema:"format=date"`
+	LastRotatedAt Timestamp `schema:"format=date"`
 	Usage         string
 	Help          string
-	ProjectUrl    string
+	ProjectUrl    string `schema:"format=uri"`
 	Username      string
 	Password      string
 	Credential    string
-	Url           string
+	Url           string `schema:"format=uri"`
 }
 
 type NoteObject interface{}
@@ -59,9 +73,20 @@ type NoteObject interface{}
 type LPassSecureNote struct {
 	EntryInfo  *LPassEntry
 	Properties map[string]string
-	Credential *StandardCredential
-	Notes      NoteObject
-	RawNotes   string
+	Credential *StandardCredential `json:",omitempty"`
+	// NB: CredentialSources and CredentialWarnings describe how the
+	// Credential was filled in, see BuildStandardCredential
+	CredentialSources  map[string]string `json:",omitempty"`
+	CredentialWarnings []string          `json:",omitempty"`
+	Notes              NoteObject
+	RawNotes           string
+	// NB: Typed is a read only view of the Properties for the built in
+	// note types (see NoteTypes), eg: *SSHKeyNote
+	Typed interface{} `json:",omitempty"`
+	// NB: Certificates is a read only view of the certificates in the Properties
+	Certificates []*CertificateInfo `json:",omitempty"`
+	// notesErr is why RawNotes couldn't be parsed into Notes
+	notesErr error
 }
 
 func (self *LPassSecureNote) GetString(k string) string {
@@ -71,26 +96,12 @@ func (self *LPassSecureNote) GetString(k string) string {
 }
 
 func (self *LPass) Exec(args []string) (*exec.Cmd, error) {
-	// TODO: cache or otherwise remember this lookup?
-	binaryPath, err := exec.LookPath("lpass")
-
-	if err != nil {
-		// TODO: log / output the error
-		log.Fatal(fmt.Sprintf("LPass: Error: unable to find the lpass binary: %s\n", err.Error()))
-		return nil, err
-	}
-
-	log.Println(fmt.Sprintf("LPass.Exec: found lpass binary at %s\n", binaryPath))
-	log.Println(fmt.Sprintf("LPass.Exec: executing lpass with args=%q\n", args))
-
-	childProcess := exec.Command(binaryPath, args...)
-	return childProcess, nil
+	return NewLPassCli().Exec(args)
 }
 
 func (self *LPass) Help(args []string) (*exec.Cmd, error) {
 	childProc, err := self.Exec([]string{"help"})
 	if err != nil {
-		log.Fatal(fmt.Sprintf("LPass: Error: executing help returned an error: %s\n", err.Error()))
 		return nil, err
 	}
 
@@ -110,90 +121,279 @@ func (self *LPass) Help(args []string) (*exec.Cmd, error) {
 // NB: since it uses a password reader we probably have to do an exec
 func (self *LPass) Login(args []string) (*exec.Cmd, error) {
 	if self.Username == "" {
-		panic("Error: you have to set your lastpass username!")
+		return nil, fmt.Errorf("you have to set your lastpass username (--username or LPASSUSER)")
 	}
 
 	binaryPath, err := exec.LookPath("lpass")
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %s", ErrBinaryNotFound, err)
 	}
 
 	argv := []string{binaryPath, "login", "--trust", self.Username}
 	env := os.Environ()
 	fmt.Printf("Executing: %s\n", argv)
+	// NB: on success this never returns, the process is replaced by lpass
 	err = syscall.Exec(binaryPath, argv, env)
-	if err != nil {
-		panic(err)
+
+	return nil, err
+}
+
+func (self *LPass) stdin() io.Reader {
+	if self.Stdin == nil {
+		return os.Stdin
 	}
 
-	panic("WHOAH, it shouldn't be possible to get here!")
+	return self.Stdin
+}
 
-	return nil, nil
+// NB: prompts go to stderr so they don't end up in any json on stdout
+func (self *LPass) confirm(prompt string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", prompt)
+	if self.stdinLines == nil {
+		self.stdinLines = bufio.NewReader(self.stdin())
+	}
+	line, _ := self.stdinLines.ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
 }
 
-func ParseLPassEntry(s string) *LPassEntry {
-	ent := &LPassEntry{}
-	ent.Parse(s)
-	return ent
+// withLogin runs fn, and if the lpass session has expired and AutoLogin
+// is on, offers to log in and then runs fn one more time
+func (self *LPass) withLogin(fn func() error) error {
+	err := fn()
+	if !errors.Is(err, ErrNotLoggedIn) || !self.AutoLogin {
+		return err
+	}
+
+	loginBackend, ok := self.backend().(LoginBackend)
+	if !ok || self.Username == "" {
+		return err
+	}
+
+	// NB: only one worker at a time gets to prompt, the rest retry once it's done
+	self.loginLock.Lock()
+	defer self.loginLock.Unlock()
+
+	err = fn()
+	if !errors.Is(err, ErrNotLoggedIn) {
+		return err
+	}
+
+	if !self.confirm(fmt.Sprintf("Your lastpass session has expired, login as %s now?", self.Username)) {
+		return err
+	}
+
+	loginErr := loginBackend.Login(self.Username)
+	if loginErr != nil {
+		return loginErr
+	}
+
+	return fn()
 }
 
-func (self *LPassEntry) Parse(line string) *LPassEntry {
-	parts := strings.SplitN(line, "\t", 9)
+// NB: the list output is positional, everything after the modification
+// time is optional (older versions of lpass don't support them)
+const minLPassEntryFields = 6
 
-	if len(parts) < 6 {
-		panic(fmt.Sprintf("Error: expected at least 6 parts, got %d from '%s'",
-			len(parts),
-			line))
+type lpassEntryField struct {
+	Index  int
+	Format string
+	Json   string
+	Name   string
+}
+
+var lpassEntryFieldList = buildLPassEntryFields()
+
+// lpassEntryFields are the fields of LPassEntry with a LPassListFormat tag,
+// in the order they appear in the struct (and so in the list output)
+func lpassEntryFields() []*lpassEntryField {
+	return lpassEntryFieldList
+}
+
+func buildLPassEntryFields() []*lpassEntryField {
+	fields := make([]*lpassEntryField, 0)
+	typ := reflect.TypeOf(LPassEntry{})
+	for idx := 0; idx < typ.NumField(); idx++ {
+		format, ok := typ.Field(idx).Tag.Lookup("LPassListFormat")
+		if !ok {
+			continue
+		}
+
+		jsonName := strings.Split(typ.Field(idx).Tag.Get("json"), ",")[0]
+		fields = append(fields, &lpassEntryField{Index: idx, Format: format, Json: jsonName, Name: typ.Field(idx).Name})
 	}
 
-	cleanedParts := make([]string, len(parts))
+	return fields
+}
 
-	for idx, s := range parts {
-		cleanedParts[idx] = strings.TrimSuffix(s, "/")
+// NB: lpass prints values verbatim, so its list output is framed with the
+// ascii unit and record separators rather than tabs and newlines, which
+// are common in values.  lpass can't escape the separators either, a value
+// that contains one can't be framed (see ParseLPassList).
+const (
+	lpassFieldSeparator  = "\x1f"
+	lpassRecordSeparator = "\x1e"
+)
+
+// LPassListFormat is the --format for `lpass ls` that ParseLPassList
+// expects: the LPassListFormat codes separated by lpassFieldSeparator,
+// terminated by lpassRecordSeparator (lpass adds a newline after that).
+// Values containing \x1f or \x1e break the framing, ParseLPassList
+// reports the ones that leave a record with the wrong number of fields,
+// but a \x1e in the last field followed by a whole record's worth of
+// \x1f's reads as an extra entry.
+func LPassListFormat() string {
+	formats := make([]string, 0)
+	for _, field := range lpassEntryFields() {
+		formats = append(formats, field.Format)
 	}
 
-	self.AccountId = cleanedParts[0]
-	self.AccountName = cleanedParts[1]
-	self.AccountNameIncludingPath = cleanedParts[2]
-	self.AccountUser = cleanedParts[3]
-	self.AccountPassword = cleanedParts[4]
-	if len(cleanedParts) > 5 {
-		self.AccountModificationTime = cleanedParts[5]
+	return strings.Join(formats, lpassFieldSeparator) + lpassRecordSeparator
+}
+
+// UnmarshalJSON accepts both the json tag names and, for credential.json
+// files written before the tags took effect, the Go field names
+func (self *LPassEntry) UnmarshalJSON(data []byte) error {
+	var m map[string]*string
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		return err
 	}
-	if len(cleanedParts) > 6 {
-		self.AccountLastTouchTime = cleanedParts[6]
+
+	val := reflect.ValueOf(self).Elem()
+	for _, field := range lpassEntryFields() {
+		v, ok := m[field.Json]
+		if !ok {
+			v = m[field.Name]
+		}
+		if v != nil {
+			val.Field(field.Index).SetString(*v)
+		}
 	}
-	if len(cleanedParts) > 7 {
-		self.AccountShareName = cleanedParts[7]
+
+	return nil
+}
+
+func ParseLPassEntry(s string) (*LPassEntry, error) {
+	return (&LPassEntry{}).Parse(s)
+}
+
+// Parse is the inverse of ToString: tab separated fields with backslashes,
+// tabs and newlines escaped.  Raw `lpass ls` output isn't escaped, it's
+// parsed by ParseLPassList (see LPassListFormat).
+func (self *LPassEntry) Parse(line string) (*LPassEntry, error) {
+	fields := lpassEntryFields()
+	parts := strings.Split(line, "\t")
+
+	if len(parts) < minLPassEntryFields || len(parts) > len(fields) {
+		return nil, &ParseError{
+			Line: 1,
+			Text: line,
+			Msg:  fmt.Sprintf("expected %d to %d fields, got %d", minLPassEntryFields, len(fields), len(parts)),
+		}
 	}
-	if len(cleanedParts) > 8 {
-		self.AccountGroupName = cleanedParts[8]
+
+	vals := make([]string, len(parts))
+	for idx, s := range parts {
+		val, err := unescapeLPassEntryValue(strings.TrimSuffix(s, "/"))
+		if err != nil {
+			return nil, &ParseError{Line: 1, Text: line, Msg: fmt.Sprintf("field %d: %s", idx+1, err)}
+		}
+		vals[idx] = val
+	}
+
+	return self.setValues(vals), nil
+}
+
+// parseFramed parses one record of lpass output in the LPassListFormat,
+// which always has every field
+func (self *LPassEntry) parseFramed(record string) (*LPassEntry, error) {
+	fields := lpassEntryFields()
+	parts := strings.Split(record, lpassFieldSeparator)
+
+	if len(parts) != len(fields) {
+		// NB: the record has the password in it, the error only names the entry
+		return nil, &ParseError{
+			Line: 1,
+			Text: "id: " + parts[0],
+			Msg:  fmt.Sprintf("expected %d fields, got %d, a value contains a \\x1f or \\x1e", len(fields), len(parts)),
+		}
+	}
+
+	return self.setValues(parts), nil
+}
+
+func (self *LPassEntry) setValues(vals []string) *LPassEntry {
+	fields := lpassEntryFields()
+	val := reflect.ValueOf(self).Elem()
+	for idx, s := range vals {
+		val.Field(fields[idx].Index).SetString(s)
 	}
 
 	return self
 }
 
+var lpassEntryEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+func unescapeLPassEntryValue(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+
+	var buf strings.Builder
+	for ii := 0; ii < len(s); ii++ {
+		if s[ii] != '\\' {
+			buf.WriteByte(s[ii])
+			continue
+		}
+
+		ii++
+		if ii == len(s) {
+			return "", fmt.Errorf("trailing \\ in '%s'", s)
+		}
+
+		switch s[ii] {
+		case '\\':
+			buf.WriteByte('\\')
+		case 't':
+			buf.WriteByte('\t')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		default:
+			return "", fmt.Errorf("unknown escape \\%c in '%s'", s[ii], s)
+		}
+	}
+
+	return buf.String(), nil
+}
+
 func (self *LPassEntry) ToArray() []string {
-	return []string{
-		self.AccountId,
-		self.AccountName,
-		self.AccountNameIncludingPath,
-		self.AccountUser,
-		self.AccountPassword,
-		self.AccountModificationTime,
-		self.AccountLastTouchTime,
-		self.AccountShareName,
-		self.AccountGroupName,
+	fields := lpassEntryFields()
+	val := reflect.ValueOf(self).Elem()
+
+	vals := make([]string, len(fields))
+	for idx, field := range fields {
+		vals[idx] = val.Field(field.Index).String()
 	}
+
+	return vals
 }
 
+// ToString is a single line, tab separated form of the entry: each value
+// has \, tab, newline and carriage return escaped and a / appended, so
+// empty values and values ending in / survive Parse
 func (self *LPassEntry) ToString() string {
-	vals := make([]string, 0)
+	vals := self.ToArray()
 
-	for _, s := range self.ToArray() {
-		if s != "" {
-			vals = append(vals, s+"/")
-		}
+	// NB: trailing empty values are optional
+	for len(vals) > minLPassEntryFields && vals[len(vals)-1] == "" {
+		vals = vals[:len(vals)-1]
+	}
+
+	for idx, s := range vals {
+		vals[idx] = lpassEntryEscaper.Replace(s) + "/"
 	}
 
 	return strings.Join(vals, "\t")
@@ -227,58 +427,128 @@ func (self *LPassSecureNote) ToJson() []byte {
 	return b
 }
 
-func ParseLPassList(s string) []*LPassEntry {
-	lines := strings.Split(s, "\n")
+// ParseLPassList parses the output of `lpass ls --format=LPassListFormat()`,
+// or one ToString'd entry per line
+func ParseLPassList(s string) ([]*LPassEntry, error) {
+	if !strings.Contains(s, lpassRecordSeparator) {
+		return parseLPassListLines(s)
+	}
 
-	// fmt.Fprintf(os.Stderr, "ParseLPassList: got %d lines\n", len(lines))
+	entries := make([]*LPassEntry, 0)
+	line := 1
+	records := strings.Split(s, lpassRecordSeparator)
+
+	for idx, record := range records {
+		// NB: lpass ends each record with a newline after the separator
+		if idx > 0 {
+			record = strings.TrimPrefix(record, "\n")
+		}
+
+		if record == "" && idx < len(records)-1 {
+			prev := "the start"
+			if len(entries) > 0 {
+				prev = "id: " + entries[len(entries)-1].AccountId
+			}
+			return nil, &ParseError{Line: line, Text: prev, Msg: "empty record, a value contains a \\x1e"}
+		}
+
+		if record == "" {
+			continue
+		}
+
+		ent, err := (&LPassEntry{}).parseFramed(record)
+		if err != nil {
+			err.(*ParseError).Line = line
+			return nil, err
+		}
+		entries = append(entries, ent)
+		line += strings.Count(record, "\n") + 1
+	}
+
+	return entries, nil
+}
+
+func parseLPassListLines(s string) ([]*LPassEntry, error) {
+	lines := strings.Split(s, "\n")
 
 	entries := make([]*LPassEntry, 0)
 
-	for _, line := range lines {
+	for idx, line := range lines {
 		if line == "" {
 			continue
 		}
-		entries = append(entries, ParseLPassEntry(line))
+		ent, err := ParseLPassEntry(line)
+		if err != nil {
+			err.(*ParseError).Line = idx + 1
+			return nil, err
+		}
+		entries = append(entries, ent)
 	}
 
-	return entries
+	return entries, nil
 }
 
+// NB: bump the version whenever LPassListFormat changes, so stale caches are ignored
+const listCacheKey = "List.v2.dat"
+
+// GetList returns the entries in the vault that match self.Filter
 func (self *LPass) GetList(args []string) ([]*LPassEntry, error) {
+	entries, err := self.getAllEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	return self.Filter.Apply(entries), nil
+}
+
+func (self *LPass) getAllEntries() ([]*LPassEntry, error) {
 	// ls --format=""
 	// TODO: add args into the cached file name (even if we sha everything)
 	// TODO: need support for turning this off & on
-	var childProc *exec.Cmd = nil
 	var response []byte
 	var found bool
 	var err error
 	// TODO: only if caching is enabled
-	response, found = self.cacheGet("List.dat")
+	response, found, err = self.cacheGet(listCacheKey)
+	if err != nil {
+		return nil, err
+	}
 
 	if !found {
-		childProc, err = self.Exec(append([]string{"ls", "--format=%/ai\t%/an\t%/aN\t%/au\t%/ap\t%/am\t%/aU\t%/as\t%/ag"}))
+		var output string
+		err = self.withLogin(func() error {
+			output, err = self.backend().List(LPassListFormat())
+			return err
+		})
 		if err != nil {
-			log.Fatal(fmt.Sprintf("LPass: Error: executing help returned an error: %s\n", err.Error()))
 			return nil, err
 		}
-		response, err = childProc.CombinedOutput()
+		response = []byte(output)
+	}
+
+	entries, err := ParseLPassList(string(response))
+	if err != nil {
+		return nil, err
 	}
 
 	// TODO: only if caching is enabled
-	entries := ParseLPassList(string(response))
-	self.cachePut("List.dat", string(response))
+	err = self.cachePut(listCacheKey, string(response))
+	if err != nil {
+		return nil, err
+	}
+
 	return entries, nil
 }
 
 func (self *LPass) List(args []string) (*exec.Cmd, error) {
 	entries, err := self.GetList(args)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	b, err := json.MarshalIndent(entries, "", "  ")
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	fmt.Print(string(b))
 
@@ -290,24 +560,38 @@ func ParseShowFirstLine(s string) (*LPassEntry, error) {
 	spos := strings.Index(s, "[")
 	epos := strings.LastIndex(s, "]")
 
-	if spos == -1 || epos == -1 {
-		panic(fmt.Sprintf("Error: expected show's first line to have properties, it was: '%s'", s))
+	if spos == -1 || epos == -1 || epos < spos {
+		return nil, &ParseError{
+			Line: 1,
+			Text: s,
+			Msg:  "expected show's first line to have properties",
+		}
 	}
 
 	accountNameIncludingPath := strings.Trim(s[0:spos], " \t\r\n")
-	lastSlashPos := strings.LastIndex(accountNameIncludingPath, "/")
-	var accountName string
-	if lastSlashPos != -1 {
-		accountName = strings.Trim(s[lastSlashPos+1:spos-1], " \t\r\n")
-	} else {
-		accountName = strings.Trim(s[0:spos-1], " \t\r\n")
+	if accountNameIncludingPath == "" {
+		return nil, &ParseError{
+			Line: 1,
+			Text: s,
+			Msg:  "expected show's first line to start with the entry name",
+		}
 	}
 
+	accountName := accountNameIncludingPath[strings.LastIndex(accountNameIncludingPath, "/")+1:]
+	accountName = strings.Trim(accountName, " \t\r\n")
+
 	pairs := strings.Split(s[spos+1:epos], ", ")
 	parts := make(map[string]string)
 
 	for _, pair := range pairs {
 		kv := strings.SplitN(pair, ": ", 2)
+		if len(kv) != 2 {
+			return nil, &ParseError{
+				Line: 1,
+				Text: s,
+				Msg:  fmt.Sprintf("expected 'key: value' properties, got '%s'", pair),
+			}
+		}
 		parts[kv[0]] = strings.Trim(kv[1], " \t\r\n")
 	}
 
@@ -320,35 +604,74 @@ func ParseShowFirstLine(s string) (*LPassEntry, error) {
 	return ent, nil
 }
 
-// NB: end_marker is a prefix
-func ParseMultlineField(start_line int, lines []string, end_marker string) (next_line int, val string) {
-	found_end := false
-	var end_line int
-	for end_line = start_line; end_line < len(lines); end_line++ {
-		if strings.HasPrefix(lines[end_line], end_marker) {
-			found_end = true
-			break
-		}
+// pemBeginRegexp matches the first line of a PEM block (-----BEGIN X-----,
+// including OpenSSH private keys) or an RFC4716 SSH public key (---- BEGIN X ----)
+var pemBeginRegexp = regexp.MustCompile(`^(-----BEGIN ([A-Z0-9 ]+)-----|---- BEGIN ([A-Z0-9 ]+) ----)\s*$`)
+
+func pemEndMarker(begin string) string {
+	m := pemBeginRegexp.FindStringSubmatch(strings.TrimSpace(begin))
+	if m == nil {
+		return ""
+	}
+
+	if m[2] != "" {
+		return "-----END " + m[2] + "-----"
 	}
 
-	if !found_end {
-		panic(fmt.Sprintf("ParseMultlineField: Error: unable to find end marker[%s] before last line.  start line was '%s'",
-			end_marker,
-			lines[start_line],
-		))
+	return "---- END " + m[3] + " ----"
+}
+
+// ParseBlockField captures a property whose value is one or more PEM/SSH
+// blocks, eg: a Certificate Chain.  lines[start_line] is the first line of
+// the first block, with the "Key: " stripped.  The value keeps the original
+// lines, indentation and all.  next_line is the last line of the last block.
+func ParseBlockField(start_line int, lines []string) (next_line int, val string, err error) {
+	ii := start_line
+	for {
+		end_marker := pemEndMarker(lines[ii])
+		begin_line := ii
+
+		for ii++; ii < len(lines) && strings.TrimSpace(lines[ii]) != end_marker; ii++ {
+		}
+
+		if ii == len(lines) {
+			return start_line, "", &ParseError{
+				Line: begin_line + 1,
+				Text: lines[begin_line],
+				Msg:  fmt.Sprintf("unable to find end marker[%s] before the last line", end_marker),
+			}
+		}
+
+		// NB: concatenated blocks (chains, bundles) may be separated by blank lines
+		next := ii + 1
+		for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+			next++
+		}
+
+		if next == len(lines) || pemEndMarker(lines[next]) == "" {
+			break
+		}
+		ii = next
 	}
 
-	return end_line, strings.Join(lines[start_line:end_line], "\n")
+	return ii, strings.Join(lines[start_line:ii+1], "\n"), nil
 }
 
 func ParseShow(s string) (*LPassSecureNote, error) {
 	lines := strings.Split(s, "\n")
 
-	if len(lines) < 1 {
-		panic(fmt.Sprintf("Error: expected `lpass show` output to be multiple lines, got `%s`",
-			s))
+	if len(lines) < 1 || strings.TrimSpace(s) == "" {
+		return nil, &ParseError{
+			Line: 1,
+			Text: s,
+			Msg:  "expected `lpass show` output to be multiple lines",
+		}
 	}
 
+	// NB: blocks (certificates, keys) are taken from the untrimmed lines
+	raw := make([]string, len(lines))
+	copy(raw, lines)
+
 	for idx, line := range lines {
 		lines[idx] = strings.TrimLeft(line, " \t\n\r")
 	}
@@ -356,7 +679,7 @@ func ParseShow(s string) (*LPassSecureNote, error) {
 	note := &LPassSecureNote{}
 	ent, err := ParseShowFirstLine(lines[0])
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	note.EntryInfo = ent
 
@@ -372,32 +695,40 @@ func ParseShow(s string) (*LPassSecureNote, error) {
 		// fmt.Fprintf(os.Stderr, "ParseShow: kv[%d] %s=%s\n", ii, kv[0], kv[1])
 
 		// NB: Notes always seems to be the last item, so we'll just accumulate the remaining lines
-		if kv[0] == "Notes" {
+		if len(kv) == 2 && kv[0] == "Notes" {
 			// the value and the rest of the lines are all the note, so we just stop here
 			note.RawNotes = kv[1] + "\n" + strings.Join(lines[(ii+1):], "\n")
 			note.RawNotes = strings.TrimSuffix(note.RawNotes, "\n ")
 			break
 		}
 
-		// Certificate is a block of line:
-		if kv[0] == "Certificate" && strings.Contains(lines[ii], "-----BEGIN ") {
-			ii, note.Properties[kv[0]] = ParseMultlineField(ii, lines, "-----END CERTIFICATE-----")
-			continue
-		}
-
-		// Private Key may be oneline or multi, if it has "-----BEGIN " in the line it's multiline
-		if kv[0] == "Private Key" && strings.Contains(lines[ii], "-----BEGIN ") {
-			ii, note.Properties[kv[0]] = ParseMultlineField(ii, lines, "-----END ")
+		// NB: any property may hold PEM/SSH blocks (Certificate, Private Key, CA, ...)
+		if len(kv) == 2 && pemEndMarker(kv[1]) != "" {
+			raw[ii] = kv[1]
+			ii, note.Properties[kv[0]], err = ParseBlockField(ii, raw)
+			if err != nil {
+				return nil, err
+			}
 			continue
 		}
 
-		if kv[0] == "Public Key" && strings.Contains(lines[ii], "-----BEGIN ") {
-			ii, note.Properties[kv[0]] = ParseMultlineField(ii, lines, "-----END ")
+		// the block may also start on the line after the key
+		key := strings.TrimSuffix(strings.TrimSpace(kv[0]), ":")
+		empty := len(kv) == 1 && strings.HasSuffix(strings.TrimSpace(kv[0]), ":") || len(kv) == 2 && strings.TrimSpace(kv[1]) == ""
+		if empty && ii+1 < len(lines) && pemEndMarker(lines[ii+1]) != "" {
+			ii, note.Properties[key], err = ParseBlockField(ii+1, raw)
+			if err != nil {
+				return nil, err
+			}
 			continue
 		}
 
 		if len(kv) != 2 {
-			panic(fmt.Sprintf("Error parsing property, expected 2 fields, got %d from: '%s'", len(kv), line))
+			return nil, &ParseError{
+				Line: ii + 1,
+				Text: line,
+				Msg:  fmt.Sprintf("expected a 'key: value' property, got %d fields", len(kv)),
+			}
 		}
 
 		note.Properties[kv[0]] = strings.Trim(kv[1], " \t\r\n")
@@ -408,40 +739,28 @@ func ParseShow(s string) (*LPassSecureNote, error) {
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error deserializing Notes json, see the contents of RawNotes: %s\n", err)
 			json.Unmarshal([]byte("{}"), &note.Notes)
+			note.notesErr = err
 		}
 	}
 
 	note.EntryInfo = ent
-	note.Credential = &StandardCredential{
-		Username: note.Properties["Username"],
-		Password: note.Properties["Password"],
-		Url:      note.Properties["URL"],
-	}
+	note.rebuildViews()
 
 	return note, nil
 }
 
 func (self *LPass) Show(args []string) (*exec.Cmd, error) {
-	// lpass show --color=never --all <<id>>
-	var childProc *exec.Cmd = nil
-	var response []byte
-	var err error
-
 	if len(args) != 1 {
 		return nil, fmt.Errorf("Error: you must supply a ID")
 	}
 
-	childProc, err = self.Exec(append([]string{"show", "--color=never", "--all", args[0]}))
+	secureNote, err := self.GetSecureNote(args[0])
 	if err != nil {
-		log.Fatal(fmt.Sprintf("LPass: Error: executing help returned an error: %s\n", err.Error()))
 		return nil, err
 	}
-	response, err = childProc.CombinedOutput()
 
-	secureNote, err := ParseShow(string(response))
-
-	if err != nil {
-		return nil, err
+	for _, warning := range secureNote.CredentialWarnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
 	}
 
 	fmt.Printf(string(secureNote.ToJson()))
@@ -449,21 +768,51 @@ func (self *LPass) Show(args []string) (*exec.Cmd, error) {
 	return nil, nil
 }
 
-func (self *LPass) Spec(args []string) (*exec.Cmd, error) {
+type SpecOptions struct {
+	Type string
+}
+
+func (self *LPass) Spec(args []string, opts SpecOptions) (*exec.Cmd, error) {
 	note := &LPassSecureNote{}
 	note.EntryInfo = &LPassEntry{}
 	note.Credential = &StandardCredential{}
 	note.Properties = map[string]string{
 		"_properties": "don't fill this in, it'll be ignored",
 	}
-	note.Notes = map[string]string{
-		"_full-monty-here": "this should match your standard cred",
+
+	if opts.Type != "" {
+		nt := LookupNoteType(opts.Type)
+		if nt == nil {
+			return nil, unknownNoteTypeError(opts.Type)
+		}
+
+		note.Properties = map[string]string{
+			"_properties": "the fields of a " + nt.Name + ", fill in the ones you need",
+			"NoteType":    nt.Name,
+		}
+		for _, name := range nt.PropertyNames() {
+			note.Properties[name] = ""
+		}
+	}
+	note.Notes = map[string]interface{}{
+		"_full-monty-here": "this should match your standard cred, keys starting with _ are ignored",
+		"Name":             "",
+		"Owner":            "",
+		"Description":      "",
+		"IssuedAt":         "",
+		"IssuedBy":         "",
+		"IssuedTo":         "",
+		"ExpiresAt":        "",
+		"LastRotatedAt":    "",
+		"Usage":            "",
+		"Help":             "",
+		"ProjectUrl":       "",
 	}
 	note.RawNotes = "this is ignored"
 	data, err := json.MarshalIndent(note, "", "  ")
 
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	fmt.Printf(string(data))
@@ -472,20 +821,39 @@ func (self *LPass) Spec(args []string) (*exec.Cmd, error) {
 	return nil, nil
 }
 
-// TODO: make the parent directories for the file if they don't exist
+// EditableJson is the json of the note without its read only views (the
+// Credential, Typed and Certificates are derived from the Properties and
+// Notes), so editing it can't look like a change that's then ignored
+func (self *LPassSecureNote) EditableJson() ([]byte, error) {
+	editable, err := self.Copy()
+	if err != nil {
+		return nil, err
+	}
+
+	editable.Credential = nil
+	editable.CredentialSources = nil
+	editable.CredentialWarnings = nil
+	editable.Typed = nil
+	editable.Certificates = nil
+
+	return editable.ToJson(), nil
+}
+
+// WriteJsonToFile writes the EditableJson
 func (self *LPassSecureNote) WriteJsonToFile(fname string) error {
 	dname := filepath.Dir(fname)
 
-	if _, err := os.Stat(dname); !os.IsNotExist(err) {
+	err := os.MkdirAll(dname, 0700)
+	if err != nil {
 		return err
 	}
 
-	err := os.MkdirAll(dname, 0700)
+	data, err := self.EditableJson()
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(fname, self.ToJson(), 0600)
+	err = ioutil.WriteFile(fname, data, 0600)
 	if err != nil {
 		return err
 	}
@@ -494,14 +862,16 @@ func (self *LPassSecureNote) WriteJsonToFile(fname string) error {
 }
 
 func (self *LPass) GetSecureNote(id_or_name string) (*LPassSecureNote, error) {
-	childProc, err := self.Exec(append([]string{"show", "--color=never", "--all", id_or_name}))
+	var response string
+	err := self.withLogin(func() (err error) {
+		response, err = self.backend().Show(id_or_name)
+		return err
+	})
 	if err != nil {
-		log.Fatal(fmt.Sprintf("LPass: Error: executing help returned an error: %s\n", err.Error()))
 		return nil, err
 	}
-	response, err := childProc.CombinedOutput()
 
-	secureNote, err := ParseShow(string(response))
+	secureNote, err := ParseShow(response)
 
 	if err != nil {
 		return nil, err
@@ -511,6 +881,10 @@ func (self *LPass) GetSecureNote(id_or_name string) (*LPassSecureNote, error) {
 }
 
 func (self *LPass) Fetch(args []string) (*exec.Cmd, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("Error: you must supply a ID")
+	}
+
 	secureNote, err := self.GetSecureNote(args[0])
 
 	if err != nil {
@@ -524,30 +898,161 @@ func (self *LPass) Fetch(args []string) (*exec.Cmd, error) {
 		fname,
 	)
 
-	secureNote.WriteJsonToFile(fname)
+	err = secureNote.WriteJsonToFile(fname)
+	if err != nil {
+		return nil, err
+	}
 
 	return nil, nil
 }
 
-func (self *LPass) SyncToLocal(args []string) (*exec.Cmd, error) {
-	// HERE HERE HERE
+type SyncDownOptions struct {
+	Parallel int
+	Prune    bool
+}
+
+// SyncToLocal writes each entry to the CredentialsFolder.  Only entries
+// that are new, or whose modification time changed since the last
+// sync-down (see SyncDownManifest), are fetched from lastpass.  What's
+// written is also the base snapshot Sync three-way merges against.
+func (self *LPass) SyncToLocal(args []string, opts SyncDownOptions) (*exec.Cmd, error) {
+	// NB: the modification times have to be current, a cached listing would hide changes
+	err := self.cacheInvalidate(listCacheKey)
+	if err != nil {
+		return nil, err
+	}
+
 	entries, err := self.GetList(args)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	fmt.Printf("Saving off %d entries...\n", len(entries))
+	manifest, err := self.readSyncDownManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	// NB: entries missing from the index are re-fetched, which is how an
+	// unreadable index gets rebuilt
+	index, err := self.readSearchIndex()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Rebuilding the search index: %s\n", err)
+	}
+	if index == nil {
+		index = NewSearchIndex()
+	}
+
+	added, changed, removed, unchanged := 0, 0, 0, 0
+	stale := make([]*LPassEntry, 0)
 	for _, entry := range entries {
-		note, err := self.GetSecureNote(entry.AccountId)
-		if err != nil {
-			panic(err)
+		prev, ok := manifest[entry.AccountId]
+		if ok && prev.ModificationTime == entry.AccountModificationTime && FileExists(prev.Path) && index.Has(entry.AccountId) && FileExists(self.baseSnapshotPath(entry.AccountId)) {
+			unchanged++
+			continue
 		}
+		stale = append(stale, entry)
+	}
+
+	fmt.Printf("Saving off %d of %d entries...\n", len(stale), len(entries))
+	notes, errs := self.FetchSecureNotes(stale, opts.Parallel)
+
+	// NB: write in listing order so the output doesn't depend on which worker finished first
+	for ii, note := range notes {
+		if errs[ii] != nil {
+			continue
+		}
+
 		fname := note.EntryInfo.ToPath(self.CredentialsFolder)
-		note.WriteJsonToFile(fname)
+		errs[ii] = note.WriteJsonToFile(fname)
+		if errs[ii] != nil {
+			continue
+		}
 		fmt.Printf("  %s\n", fname)
+
+		// NB: the local copy now matches lastpass, it's the base for the next sync
+		errs[ii] = self.writeBaseSnapshot(note)
+		if errs[ii] != nil {
+			continue
+		}
+
+		// NB: a renamed entry moves, don't leave the old copy behind
+		if prev, ok := manifest[stale[ii].AccountId]; ok {
+			changed++
+			if prev.Path != fname {
+				errs[ii] = self.removeLocalFile(prev.Path)
+			}
+		} else {
+			added++
+		}
+
+		manifest[stale[ii].AccountId] = &SyncDownManifestEntry{
+			ModificationTime: stale[ii].AccountModificationTime,
+			Path:             fname,
+		}
+		index.Put(stale[ii], note)
 	}
-	fmt.Printf("done.")
-	return nil, nil
+
+	failures := make([]error, 0)
+	for ii, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", stale[ii].AccountNameIncludingPath, err))
+		}
+	}
+
+	// NB: entries excluded by the filter are still in lastpass, they mustn't be pruned
+	all, err := self.getAllEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]bool)
+	for _, entry := range all {
+		current[entry.AccountId] = true
+	}
+
+	gone := 0
+	for _, id := range manifest.Ids() {
+		if current[id] {
+			continue
+		}
+
+		if !opts.Prune {
+			fmt.Printf("  %s is no longer in lastpass (use --prune to remove it)\n", manifest[id].Path)
+			gone++
+			continue
+		}
+
+		err = self.removeLocalFile(manifest[id].Path)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", manifest[id].Path, err))
+			continue
+		}
+		err = self.removeBaseSnapshot(id)
+		if err != nil {
+			failures = append(failures, err)
+		}
+		fmt.Printf("  removed %s\n", manifest[id].Path)
+		delete(manifest, id)
+		index.Remove(id)
+		removed++
+	}
+
+	err = self.writeSyncDownManifest(manifest)
+	if err != nil {
+		failures = append(failures, err)
+	}
+
+	err = self.writeSearchIndex(index)
+	if err != nil {
+		failures = append(failures, err)
+	}
+
+	fmt.Printf("done, %d added, %d changed, %d removed, %d unchanged, %d errors.\n", added, changed, removed, unchanged, len(failures))
+	if gone > 0 {
+		fmt.Printf("%d local credentials are no longer in lastpass, use --prune to remove them.\n", gone)
+	}
+
+	return nil, errors.Join(failures...)
 }
 
 func defaultUserName() string {
@@ -587,26 +1092,38 @@ func DirExists(dname string) bool {
 	return FileExists(dname)
 }
 
-func (self *LPass) cacheGet(key string) ([]byte, bool) {
+func (self *LPass) cacheGet(key string) ([]byte, bool, error) {
 	cfile := path.Join(self.Cachedir, key)
 
 	if FileExists(cfile) {
 		bytes, err := ioutil.ReadFile(cfile)
 		if err != nil {
-			log.Fatalf("Error reading cache file: %s for key %s : %s", cfile, key, err)
+			return nil, false, &CacheError{Op: "read", Key: key, Path: cfile, Err: err}
 		}
-		return bytes, true
+		return bytes, true, nil
 	}
 
-	return []byte{}, false
+	return []byte{}, false, nil
 }
 
-func (self *LPass) cachePut(key, value string) {
+func (self *LPass) cachePut(key, value string) error {
 	cfile := path.Join(self.Cachedir, key)
 	err := ioutil.WriteFile(cfile, []byte(value), 0600)
 	if err != nil {
-		log.Fatalf("Error writing cache file: %s for key %s : %s", cfile, key, err)
+		return &CacheError{Op: "write", Key: key, Path: cfile, Err: err}
+	}
+
+	return nil
+}
+
+func (self *LPass) cacheInvalidate(key string) error {
+	cfile := path.Join(self.Cachedir, key)
+	err := os.Remove(cfile)
+	if err != nil && !os.IsNotExist(err) {
+		return &CacheError{Op: "remove", Key: key, Path: cfile, Err: err}
 	}
+
+	return nil
 }
 
 func main() {
@@ -614,6 +1131,7 @@ func main() {
 	lpass := &LPass{
 		Username: defaultUserName(),
 		Cachedir: "./.rlpass/cache",
+		Backend:  NewLPassCli(),
 	}
 
 	app := cli.NewApp()
@@ -636,6 +1154,11 @@ func main() {
 			Value: "./.rlpass/cache",
 			Usage: "Local cache directory",
 		},
+		cli.BoolFlag{
+			Name:   "auto-login",
+			Usage:  "Offer to run `lpass login` when the lastpass session has expired",
+			EnvVar: "RLPASS_AUTO_LOGIN",
+		},
 	}
 
 	app.Commands = []cli.Command{
@@ -644,8 +1167,8 @@ func main() {
 			Aliases: []string{"h"},
 			Usage:   "show this help",
 			Action: func(c *cli.Context) error {
-				lpass.Help(c.Args())
-				return nil
+				_, err := lpass.Help(c.Args())
+				return cliError(err)
 			},
 		},
 		{
@@ -653,17 +1176,59 @@ func main() {
 			Aliases: []string{"l"},
 			Usage:   "shell out to lpass to login",
 			Action: func(c *cli.Context) error {
-				lpass.Login(c.Args())
-				return nil
+				_, err := lpass.Login(c.Args())
+				return cliError(err)
 			},
 		},
 		{
 			Name:    "list",
 			Aliases: []string{"ls"},
 			Usage:   "list your lastpass credentials, emits json",
+			Flags:   listFilterFlags,
 			Action: func(c *cli.Context) error {
-				lpass.List(c.Args())
-				return nil
+				filter, err := listFilterFromContext(c)
+				if err != nil {
+					return cliError(err)
+				}
+				lpass.Filter = filter
+
+				_, err = lpass.List(c.Args())
+				return cliError(err)
+			},
+		},
+		{
+			Name:      "search",
+			Aliases:   []string{"find"},
+			Usage:     "search names, properties and notes, emits json",
+			ArgsUsage: "[field:]text|/regex/ ...",
+			Flags: append([]cli.Flag{
+				cli.BoolFlag{
+					Name:  "show-secrets",
+					Usage: "Search and show the values of every field, not just the names, owners, urls, dates and the like",
+				},
+				cli.BoolFlag{
+					Name:  "offline",
+					Usage: "Search the local index written by sync-down instead of lastpass (never includes secrets)",
+				},
+				cli.IntFlag{
+					Name:  "parallel, p",
+					Value: 4,
+					Usage: "Number of entries to fetch from lastpass concurrently",
+				},
+			}, listFilterFlags...),
+			Action: func(c *cli.Context) error {
+				filter, err := listFilterFromContext(c)
+				if err != nil {
+					return cliError(err)
+				}
+				lpass.Filter = filter
+
+				_, err = lpass.Search(c.Args(), SearchOptions{
+					ShowSecrets: c.Bool("show-secrets"),
+					Offline:     c.Bool("offline"),
+					Parallel:    c.Int("parallel"),
+				})
+				return cliError(err)
 			},
 		},
 		{
@@ -671,33 +1236,261 @@ func main() {
 			Aliases: []string{"cat"},
 			Usage:   "show a json formatted credential",
 			Action: func(c *cli.Context) error {
-				lpass.Show(c.Args())
-				return nil
+				_, err := lpass.Show(c.Args())
+				return cliError(err)
 			},
 		},
 		{
 			Name:    "spec",
 			Aliases: []string{"cat"},
 			Usage:   "json template for a secret note",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "type",
+					Usage: "Template for one of the built in note types: " + strings.Join(NoteTypeSlugs(), ", "),
+				},
+			},
 			Action: func(c *cli.Context) error {
-				lpass.Spec(c.Args())
-				return nil
+				_, err := lpass.Spec(c.Args(), SpecOptions{Type: c.String("type")})
+				return cliError(err)
+			},
+		},
+		{
+			Name:      "migrate",
+			Usage:     "Rewrite legacy notes to match the StandardCredential schema, backing up the originals first",
+			ArgsUsage: "[ID|name ...]",
+			Flags: append([]cli.Flag{
+				cli.BoolFlag{
+					Name:  "all",
+					Usage: "Migrate every entry in lastpass that doesn't match the schema",
+				},
+				cli.StringFlag{
+					Name:  "owner",
+					Usage: "The Owner for notes that don't have one",
+				},
+				cli.BoolFlag{
+					Name:  "yes, y",
+					Usage: "Don't ask before migrating each entry",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run, n",
+					Usage: "Show the proposed rewrites but don't change anything",
+				},
+				cli.StringFlag{
+					Name:  "backup-dir",
+					Usage: "Where to write the original notes, defaults to <cachedir>/backups/migrate-<time>",
+				},
+			}, listFilterFlags...),
+			Action: func(c *cli.Context) error {
+				filter, err := listFilterFromContext(c)
+				if err != nil {
+					return cliError(err)
+				}
+				lpass.Filter = filter
+
+				_, err = lpass.Migrate(c.Args(), MigrateOptions{
+					All:       c.Bool("all"),
+					Owner:     c.String("owner"),
+					Yes:       c.Bool("yes"),
+					DryRun:    c.Bool("dry-run"),
+					BackupDir: c.String("backup-dir"),
+				})
+				return cliError(err)
+			},
+		},
+		{
+			Name:  "expiring",
+			Usage: "List the credentials that have expired or will soon, exits 9 if any have expired",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "within, w",
+					Value: "30d",
+					Usage: "How far ahead to look, eg: 30d, 2w, 1y",
+				},
+				cli.StringFlag{
+					Name:  "sort",
+					Value: "date",
+					Usage: "date or owner",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Value: "text",
+					Usage: "text, json or csv",
+				},
+			}, listFilterFlags...),
+			Action: func(c *cli.Context) error {
+				filter, err := listFilterFromContext(c)
+				if err != nil {
+					return cliError(err)
+				}
+				lpass.Filter = filter
+
+				_, err = lpass.Expiring(c.Args(), ExpiringOptions{
+					Within: c.String("within"),
+					Sort:   c.String("sort"),
+					Format: c.String("format"),
+				})
+				return cliError(err)
+			},
+		},
+		{
+			Name:      "validate",
+			Usage:     "Check entries, or local json files, against the StandardCredential schema",
+			ArgsUsage: "[ID|name|file.json ...]",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "all",
+					Usage: "Check every entry in lastpass",
+				},
+				cli.BoolFlag{
+					Name:  "schema",
+					Usage: "Print the StandardCredential JSON Schema",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				_, err := lpass.Validate(c.Args(), ValidateOptions{
+					All:    c.Bool("all"),
+					Schema: c.Bool("schema"),
+				})
+				return cliError(err)
+			},
+		},
+		{
+			Name:      "add",
+			Usage:     "Create a lastpass entry from a json secure note (see spec), reads stdin if no file is given",
+			ArgsUsage: "[note.json]",
+			Action: func(c *cli.Context) error {
+				_, err := lpass.Add(c.Args())
+				return cliError(err)
+			},
+		},
+		{
+			Name:      "update",
+			Usage:     "Apply a full or partial json secure note to an existing entry, reads stdin if no file is given",
+			ArgsUsage: "<id|name> [note.json]",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Show the changes without saving them",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				_, err := lpass.Update(c.Args(), UpdateOptions{DryRun: c.Bool("dry-run")})
+				return cliError(err)
+			},
+		},
+		{
+			Name:      "edit",
+			Usage:     "Edit a secure note's json in $EDITOR and save the changes back to lastpass",
+			ArgsUsage: "<id|name>",
+			Action: func(c *cli.Context) error {
+				_, err := lpass.Edit(c.Args())
+				return cliError(err)
+			},
+		},
+		{
+			Name:      "rm",
+			Usage:     "Remove entries from lastpass and the local credentials folder",
+			ArgsUsage: "<id|name|glob>...",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "yes, y",
+					Usage: "Don't ask for confirmation",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run, n",
+					Usage: "Show what would be removed without removing it",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				_, err := lpass.Remove(c.Args(), RemoveOptions{
+					Yes:    c.Bool("yes"),
+					DryRun: c.Bool("dry-run"),
+				})
+				return cliError(err)
 			},
 		},
 		{
 			Name:  "fetch",
 			Usage: "Fetch and save a credential to the local file system.",
 			Action: func(c *cli.Context) error {
-				lpass.Fetch(c.Args())
-				return nil
+				_, err := lpass.Fetch(c.Args())
+				return cliError(err)
+			},
+		},
+		{
+			Name:  "sync-up",
+			Usage: "Push the local credentials folder up to lastpass, adding and updating entries",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run, n",
+					Usage: "Show what would be added, updated or deleted without changing lastpass",
+				},
+				cli.BoolFlag{
+					Name:  "delete",
+					Usage: "Remove lastpass entries that have no local credential",
+				},
+				cli.BoolFlag{
+					Name:  "yes, y",
+					Usage: "Don't ask for confirmation before deleting",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				_, err := lpass.SyncToRemote(c.Args(), SyncUpOptions{
+					DryRun: c.Bool("dry-run"),
+					Delete: c.Bool("delete"),
+					Yes:    c.Bool("yes"),
+				})
+				return cliError(err)
+			},
+		},
+		{
+			Name:  "sync",
+			Usage: "Two way sync between lastpass and the local credentials folder, reporting conflicts",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run, n",
+					Usage: "Show what would be pushed, pulled and deleted without changing anything",
+				},
+				cli.BoolFlag{
+					Name:  "delete",
+					Usage: "Remove lastpass entries whose local credential was deleted",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				_, err := lpass.Sync(c.Args(), SyncOptions{
+					DryRun: c.Bool("dry-run"),
+					Delete: c.Bool("delete"),
+				})
+				return cliError(err)
 			},
 		},
 		{
 			Name:  "sync-down",
 			Usage: "Pull all credentials into the local file system",
+			Flags: append([]cli.Flag{
+				cli.IntFlag{
+					Name:  "parallel, p",
+					Value: 4,
+					Usage: "Number of entries to fetch from lastpass concurrently",
+				},
+				cli.BoolFlag{
+					Name:  "prune",
+					Usage: "Remove local credentials for entries that are no longer in lastpass",
+				},
+			}, listFilterFlags...),
 			Action: func(c *cli.Context) error {
-				lpass.SyncToLocal(c.Args())
-				return nil
+				filter, err := listFilterFromContext(c)
+				if err != nil {
+					return cliError(err)
+				}
+				lpass.Filter = filter
+
+				_, err = lpass.SyncToLocal(c.Args(), SyncDownOptions{
+					Parallel: c.Int("parallel"),
+					Prune:    c.Bool("prune"),
+				})
+				return cliError(err)
 			},
 		},
 	}
@@ -706,13 +1499,14 @@ func main() {
 		lpass.Username = c.String("username")
 		lpass.Cachedir = c.String("cachedir")
 		lpass.CredentialsFolder = c.String("credentialsFolder")
+		lpass.AutoLogin = c.Bool("auto-login")
 
 		if !DirExists(lpass.Cachedir) {
 			log.Printf("app.Action: creating: %s", lpass.Cachedir)
 			err := os.MkdirAll(lpass.Cachedir, 0700)
 			log.Printf("app.Action: created: dir=%s : err=%s", lpass.Cachedir, err)
 			if err != nil {
-				log.Fatalf("Error creating dir=%s : err=%s", lpass.Cachedir, err)
+				return cliError(&CacheError{Op: "mkdir", Key: "", Path: lpass.Cachedir, Err: err})
 			}
 		}
 		return nil
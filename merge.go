@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+type FieldConflict struct {
+	Field  string
+	Base   *string
+	Local  *string
+	Remote *string
+}
+
+func lookupField(fields map[string]string, k string) *string {
+	if v, ok := fields[k]; ok {
+		return &v
+	}
+
+	return nil
+}
+
+func sameField(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// ThreeWayMerge merges the local and remote fields (see
+// LPassSecureNote.Fields) against the base they were both last synced
+// from.  A field changed on only one side takes that side's value, a
+// field changed differently on both sides is a conflict and keeps the
+// remote value in the merged result.
+func ThreeWayMerge(base, local, remote map[string]string) (map[string]string, []*FieldConflict) {
+	keys := make(map[string]bool)
+	for _, fields := range []map[string]string{base, local, remote} {
+		for k := range fields {
+			keys[k] = true
+		}
+	}
+
+	merged := make(map[string]string)
+	conflicts := make([]*FieldConflict, 0)
+
+	for k := range keys {
+		b, l, r := lookupField(base, k), lookupField(local, k), lookupField(remote, k)
+
+		var val *string
+		switch {
+		case sameField(l, r):
+			val = l
+		case sameField(l, b):
+			val = r
+		case sameField(r, b):
+			val = l
+		default:
+			conflicts = append(conflicts, &FieldConflict{Field: k, Base: b, Local: l, Remote: r})
+			val = r
+		}
+
+		if val != nil {
+			merged[k] = *val
+		}
+	}
+
+	sort.Slice(conflicts, func(ii, jj int) bool {
+		return conflicts[ii].Field < conflicts[jj].Field
+	})
+
+	return merged, conflicts
+}
+
+// WithFields is the inverse of Fields, it returns a copy of the note with
+// its Name, Properties and Notes replaced by the given fields
+func (self *LPassSecureNote) WithFields(fields map[string]string) (*LPassSecureNote, error) {
+	note, err := self.Copy()
+	if err != nil {
+		return nil, err
+	}
+
+	note.Properties = make(map[string]string)
+	var notes map[string]interface{}
+	note.Notes = nil
+
+	for k, v := range fields {
+		switch {
+		case k == "Name":
+			if !strings.Contains(v, "/") {
+				v = "(none)/" + v
+			}
+			note.EntryInfo.AccountNameIncludingPath = v
+			note.EntryInfo.AccountName = v[strings.LastIndex(v, "/")+1:]
+		case k == "Notes":
+			err = json.Unmarshal([]byte(v), &note.Notes)
+			if err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(k, "Notes."):
+			if notes == nil {
+				notes = make(map[string]interface{})
+			}
+			var val interface{}
+			err = json.Unmarshal([]byte(v), &val)
+			if err != nil {
+				return nil, err
+			}
+			notes[strings.TrimPrefix(k, "Notes.")] = val
+		default:
+			note.Properties[k] = v
+		}
+	}
+
+	if notes != nil {
+		note.Notes = notes
+	}
+
+	note.RawNotes = ""
+	if note.Notes != nil {
+		raw, err := json.MarshalIndent(note.Notes, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		note.RawNotes = string(raw)
+	}
+
+	note.rebuildViews()
+
+	return note, nil
+}
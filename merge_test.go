@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestThreeWayMerge(t *testing.T) {
+	base := map[string]string{"Name": "a", "Owner": "infra", "Usage": "ci", "URL": "http://x"}
+	local := map[string]string{"Name": "a", "Owner": "platform", "Usage": "deploys", "URL": "http://x"}
+	remote := map[string]string{"Name": "a", "Owner": "infra", "Usage": "builds", "Help": "ask"}
+
+	merged, conflicts := ThreeWayMerge(base, local, remote)
+
+	expected := map[string]string{"Name": "a", "Owner": "platform", "Usage": "builds", "Help": "ask"}
+	if len(merged) != len(expected) {
+		t.Errorf("Error: expected %+v, got %+v", expected, merged)
+	}
+	for k, v := range expected {
+		if merged[k] != v {
+			t.Errorf("Error: expected merged[%s] to be '%s', got '%s'", k, v, merged[k])
+		}
+	}
+
+	if len(conflicts) != 1 || conflicts[0].Field != "Usage" {
+		t.Fatalf("Error: expected a single conflict on Usage, got %+v", conflicts)
+	}
+
+	if *conflicts[0].Base != "ci" || *conflicts[0].Local != "deploys" || *conflicts[0].Remote != "builds" {
+		t.Errorf("Error: unexpected conflict %+v", conflicts[0])
+	}
+}
+
+func TestThreeWayMergeDeleteVsChange(t *testing.T) {
+	base := map[string]string{"Owner": "infra"}
+
+	_, conflicts := ThreeWayMerge(base, map[string]string{}, map[string]string{"Owner": "platform"})
+	if len(conflicts) != 1 || conflicts[0].Local != nil {
+		t.Errorf("Error: expected a local delete vs remote change to conflict, got %+v", conflicts)
+	}
+
+	merged, conflicts := ThreeWayMerge(base, map[string]string{}, base)
+	if _, ok := merged["Owner"]; ok || len(conflicts) != 0 {
+		t.Errorf("Error: expected the local delete to win, got %+v / %+v", merged, conflicts)
+	}
+}
+
+func TestWithFieldsRoundTrip(t *testing.T) {
+	note, err := ParseSecureNoteJson([]byte(addNoteJson))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := note.Fields()
+	rebuilt, err := note.WithFields(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changes := DiffSecureNotes(note, rebuilt); len(changes) != 0 {
+		t.Errorf("Error: expected WithFields(Fields()) to be a no-op, got %+v", changes)
+	}
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MigrationContext is the state a MigrationRule rewrites: the proposed
+// note, its Notes and whatever free form text hasn't been migrated yet
+type MigrationContext struct {
+	Note  *LPassSecureNote
+	Notes map[string]interface{}
+	Text  []string
+	Owner string
+	// Masked are the fields holding legacy text, the proposed rewrite only
+	// shows how many lines they have, eg: Notes.Description
+	Masked map[string]bool
+}
+
+// A MigrationRule moves legacy data towards a StandardCredential, it returns
+// a line describing each thing it did.  Rules run in order, add to
+// MigrationRules to teach `rlpass migrate` about another legacy format.
+type MigrationRule struct {
+	Name  string
+	Apply func(ctx *MigrationContext) []string
+}
+
+var MigrationRules = []*MigrationRule{
+	{Name: "pem", Apply: migratePemBlocks},
+	{Name: "key-value", Apply: migrateKeyValueText},
+	{Name: "unknown-keys", Apply: migrateUnknownKeys},
+	{Name: "properties", Apply: migrateProperties},
+	{Name: "defaults", Apply: migrateDefaults},
+	{Name: "description", Apply: migrateLeftoverText},
+}
+
+// migrationFieldAliases are the legacy names for the StandardCredential
+// fields, keys are lower cased with '_' and '-' replaced by spaces
+var migrationFieldAliases = map[string]string{
+	"team":          "Owner",
+	"owned by":      "Owner",
+	"desc":          "Description",
+	"created":       "IssuedAt",
+	"created at":    "IssuedAt",
+	"issued":        "IssuedAt",
+	"issuer":        "IssuedBy",
+	"expires":       "ExpiresAt",
+	"expiry":        "ExpiresAt",
+	"expiration":    "ExpiresAt",
+	"rotated":       "LastRotatedAt",
+	"last rotated":  "LastRotatedAt",
+	"used by":       "Usage",
+	"docs":          "Help",
+	"documentation": "Help",
+	"runbook":       "Help",
+	"project":       "ProjectUrl",
+	"repo":          "ProjectUrl",
+	"user":          "Username",
+	"login":         "Username",
+	"pass":          "Password",
+	"url":           "Url",
+	"host":          "Url",
+	"hostname":      "Url",
+}
+
+// migrationField maps a legacy key to a StandardCredential field, or ""
+func migrationField(key string) string {
+	k := strings.ToLower(strings.TrimSpace(key))
+	k = strings.NewReplacer("_", " ", "-", " ").Replace(k)
+	if field, ok := migrationFieldAliases[k]; ok {
+		return field
+	}
+
+	for _, field := range standardCredentialFieldNames() {
+		if strings.ReplaceAll(k, " ", "") == strings.ToLower(field) {
+			return field
+		}
+	}
+
+	return ""
+}
+
+// setField puts a value where it belongs: the lastpass fields (Username,
+// Password, URL) and secrets go in the Properties, everything else goes in
+// the Notes.  Existing values are never overwritten, false if it wasn't set.
+func (self *MigrationContext) setField(field, key, val string) (string, bool) {
+	if prop, ok := credentialProperties[field]; ok {
+		if self.Note.Properties[prop] != "" {
+			return "", false
+		}
+		self.Note.Properties[prop] = val
+		return "Properties." + prop, true
+	}
+
+	if field == "Credential" || field == "" && isSecretField(key) {
+		if self.Note.Properties[key] != "" {
+			return "", false
+		}
+		self.Note.Properties[key] = val
+		return "Properties." + key, true
+	}
+
+	if field == "" {
+		return "", false
+	}
+
+	if s, ok := self.Notes[field].(string); ok && s != "" {
+		return "", false
+	}
+
+	if credentialDateFields[field] {
+		if normal, err := ParseCredentialDate(val); err == nil {
+			val = normal
+		}
+	}
+
+	self.Notes[field] = val
+	return "Notes." + field, true
+}
+
+func pemBlockName(begin string) string {
+	m := pemBeginRegexp.FindStringSubmatch(strings.TrimSpace(begin))
+	label := m[2] + m[3]
+	switch {
+	case strings.Contains(label, "PRIVATE KEY"):
+		return "Private Key"
+	case strings.Contains(label, "PUBLIC KEY"):
+		return "Public Key"
+	case strings.Contains(label, "CERTIFICATE"):
+		return "Certificate"
+	}
+
+	words := strings.Fields(strings.ToLower(label))
+	for idx, word := range words {
+		words[idx] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// migratePemBlocks moves keys and certificates out of the text into
+// properties, named after the "key:" line before them or the block type
+func migratePemBlocks(ctx *MigrationContext) []string {
+	did := make([]string, 0)
+	rest := make([]string, 0)
+
+	for ii := 0; ii < len(ctx.Text); ii++ {
+		if pemEndMarker(ctx.Text[ii]) == "" {
+			rest = append(rest, ctx.Text[ii])
+			continue
+		}
+
+		end, block, err := ParseBlockField(ii, ctx.Text)
+		if err != nil {
+			rest = append(rest, ctx.Text[ii])
+			continue
+		}
+
+		name := pemBlockName(ctx.Text[ii])
+		if n := len(rest); n > 0 && strings.HasSuffix(strings.TrimSpace(rest[n-1]), ":") {
+			name = strings.TrimSuffix(strings.TrimSpace(rest[n-1]), ":")
+			rest = rest[:n-1]
+		}
+
+		for base, idx := name, 2; ctx.Note.Properties[name] != ""; idx++ {
+			name = fmt.Sprintf("%s %d", base, idx)
+		}
+
+		ctx.Note.Properties[name] = block
+		did = append(did, fmt.Sprintf("moved a %d line block to Properties.%s", end-ii+1, name))
+		ii = end
+	}
+
+	ctx.Text = rest
+	return did
+}
+
+var migrationKeyValueRegexp = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z0-9 _.-]*?)\s*[:=]\s*(.*?)\s*$`)
+
+// migrateKeyValueText takes "key: value" and "key=value" lines out of the text
+func migrateKeyValueText(ctx *MigrationContext) []string {
+	did := make([]string, 0)
+	rest := make([]string, 0)
+
+	for _, line := range ctx.Text {
+		m := migrationKeyValueRegexp.FindStringSubmatch(line)
+		if m == nil || m[2] == "" {
+			rest = append(rest, line)
+			continue
+		}
+
+		dest, ok := ctx.setField(migrationField(m[1]), m[1], m[2])
+		if !ok {
+			rest = append(rest, line)
+			continue
+		}
+
+		did = append(did, fmt.Sprintf("'%s' -> %s", m[1], dest))
+	}
+
+	ctx.Text = rest
+	return did
+}
+
+// migrateUnknownKeys renames Notes keys that are aliases of a field, the
+// keys it can't place are left for migrateLeftoverText
+func migrateUnknownKeys(ctx *MigrationContext) []string {
+	did := make([]string, 0)
+	keys := make([]string, 0)
+	for k := range ctx.Notes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	known := make(map[string]bool)
+	for _, name := range standardCredentialFieldNames() {
+		known[name] = true
+	}
+
+	for _, k := range keys {
+		if known[k] || strings.HasPrefix(k, "_") {
+			continue
+		}
+
+		val, ok := ctx.Notes[k].(string)
+		if !ok {
+			b, _ := json.Marshal(ctx.Notes[k])
+			val = string(b)
+		}
+		delete(ctx.Notes, k)
+
+		if dest, ok := ctx.setField(migrationField(k), k, val); ok {
+			did = append(did, fmt.Sprintf("Notes.%s -> %s", k, dest))
+			continue
+		}
+
+		ctx.Text = append(ctx.Text, k+": "+val)
+	}
+
+	return did
+}
+
+// migrateProperties moves custom properties that are StandardCredential
+// fields (eg: Owner) into the Notes.  The lastpass fields and the fields of
+// the built in note types are left where they are.
+func migrateProperties(ctx *MigrationContext) []string {
+	did := make([]string, 0)
+	keep := map[string]bool{"Username": true, "Password": true, "URL": true, "NoteType": true}
+	if nt := ctx.Note.NoteType(); nt != nil {
+		for _, name := range nt.PropertyNames() {
+			keep[name] = true
+		}
+	}
+
+	keys := make([]string, 0)
+	for k := range ctx.Note.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		field := migrationField(k)
+		if keep[k] || field == "" || credentialProperties[field] != "" || field == "Credential" {
+			continue
+		}
+
+		if dest, ok := ctx.setField(field, k, ctx.Note.Properties[k]); ok {
+			delete(ctx.Note.Properties, k)
+			did = append(did, fmt.Sprintf("Properties.%s -> %s", k, dest))
+		}
+	}
+
+	return did
+}
+
+// migrateDefaults fills in the required fields: the Name from the entry
+// name and the Owner from `migrate --owner`
+func migrateDefaults(ctx *MigrationContext) []string {
+	did := make([]string, 0)
+	if dest, ok := ctx.setField("Name", "Name", ctx.Note.EntryInfo.AccountName); ok {
+		did = append(did, fmt.Sprintf("the entry name -> %s", dest))
+	}
+
+	if ctx.Owner != "" {
+		if dest, ok := ctx.setField("Owner", "Owner", ctx.Owner); ok {
+			did = append(did, fmt.Sprintf("--owner -> %s", dest))
+		}
+	}
+
+	return did
+}
+
+// migrateLeftoverText keeps whatever no other rule understood in the Description
+func migrateLeftoverText(ctx *MigrationContext) []string {
+	text := strings.TrimSpace(strings.Join(ctx.Text, "\n"))
+	ctx.Text = nil
+	if text == "" {
+		return nil
+	}
+
+	if desc, ok := ctx.Notes["Description"].(string); ok && desc != "" {
+		text = desc + "\n" + text
+	}
+	ctx.Notes["Description"] = text
+	ctx.Masked["Notes.Description"] = true
+
+	return []string{fmt.Sprintf("%d lines of text -> Notes.Description", strings.Count(text, "\n")+1)}
+}
+
+type Migration struct {
+	Original   *LPassSecureNote
+	Proposed   *LPassSecureNote
+	Steps      []string
+	Changes    []*FieldChange
+	Violations []*SchemaViolation
+}
+
+// ProposeMigration runs the MigrationRules over a copy of the note.  The
+// Violations are what's still wrong with the proposed note.
+func ProposeMigration(note *LPassSecureNote, owner string) (*Migration, error) {
+	proposed, err := note.Copy()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &MigrationContext{Note: proposed, Notes: make(map[string]interface{}), Owner: owner, Masked: make(map[string]bool)}
+	if notes, ok := note.Notes.(map[string]interface{}); ok && note.notesErr == nil {
+		for k, v := range notes {
+			ctx.Notes[k] = v
+		}
+	} else if strings.TrimSpace(note.RawNotes) != "" {
+		ctx.Text = strings.Split(strings.TrimSpace(note.RawNotes), "\n")
+	}
+
+	migration := &Migration{Original: note, Proposed: proposed, Steps: make([]string, 0)}
+	for _, rule := range MigrationRules {
+		for _, step := range rule.Apply(ctx) {
+			migration.Steps = append(migration.Steps, rule.Name+": "+step)
+		}
+	}
+
+	proposed.Notes = ctx.Notes
+	proposed.rebuildViews()
+
+	// NB: the Fields of notes that aren't json don't include the text
+	original := note
+	if note.notesErr != nil {
+		original, err = note.Copy()
+		if err != nil {
+			return nil, err
+		}
+		original.Notes = note.RawNotes
+	}
+
+	migration.Changes = DiffSecureNotes(original, proposed)
+	for _, change := range migration.Changes {
+		// NB: the legacy text can hold anything, including secrets
+		if change.Field == "Notes" && note.notesErr != nil {
+			change.Old = fmt.Sprintf("(%d lines of text)", len(strings.Split(strings.TrimSpace(note.RawNotes), "\n")))
+			change.summarized = true
+		}
+		if text, ok := ctx.Notes[strings.TrimPrefix(change.Field, "Notes.")].(string); ok && ctx.Masked[change.Field] {
+			change.New = fmt.Sprintf("(%d lines of text)", len(strings.Split(text, "\n")))
+			change.summarized = true
+		}
+	}
+	migration.Violations = ValidateNotes(proposed)
+	return migration, nil
+}
+
+type MigrateOptions struct {
+	All       bool
+	Owner     string
+	Yes       bool
+	DryRun    bool
+	BackupDir string
+}
+
+func (self *LPass) writeMigrationBackup(dir string, note *LPassSecureNote) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	fname := filepath.Join(dir, note.EntryInfo.AccountId+".json")
+	return ioutil.WriteFile(fname, note.ToJson(), 0600)
+}
+
+// Migrate proposes a rewrite of each note that doesn't match the
+// StandardCredential schema and applies the accepted ones.  The original of
+// every accepted note is backed up before anything is written to lastpass.
+func (self *LPass) Migrate(args []string, opts MigrateOptions) (*exec.Cmd, error) {
+	if !opts.All && len(args) == 0 {
+		return nil, fmt.Errorf("Error: you must supply an ID, name or --all")
+	}
+
+	notes := make([]*LPassSecureNote, 0)
+	var errs []error
+
+	if opts.All {
+		entries, err := self.GetList([]string{})
+		if err != nil {
+			return nil, err
+		}
+
+		fetched, fetchErrs := self.FetchSecureNotes(entries, 4)
+		for ii, entry := range entries {
+			if fetchErrs[ii] != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", entry.AccountNameIncludingPath, fetchErrs[ii]))
+				continue
+			}
+			notes = append(notes, fetched[ii])
+		}
+	}
+
+	for _, arg := range args {
+		note, err := self.GetSecureNote(arg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", arg, err))
+			continue
+		}
+		notes = append(notes, note)
+	}
+
+	accepted := make([]*Migration, 0)
+	skipped := 0
+	for _, note := range notes {
+		if len(ValidateNotes(note)) == 0 {
+			continue
+		}
+
+		migration, err := ProposeMigration(note, opts.Owner)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", note.EntryInfo.AccountNameIncludingPath, err))
+			continue
+		}
+
+		fmt.Printf("~ migrate %s [id: %s]\n", note.EntryInfo.AccountNameIncludingPath, note.EntryInfo.AccountId)
+		for _, step := range migration.Steps {
+			fmt.Printf("    # %s\n", step)
+		}
+		for _, change := range migration.Changes {
+			fmt.Printf("    %s\n", change)
+		}
+
+		if len(migration.Violations) > 0 {
+			skipped++
+			for _, v := range migration.Violations {
+				fmt.Printf("    ! %s\n", v)
+			}
+			fmt.Printf("    skipped, the proposed note still doesn't match the schema\n")
+			continue
+		}
+
+		if opts.DryRun || opts.Yes || self.confirm("Migrate "+note.EntryInfo.AccountNameIncludingPath+"?") {
+			accepted = append(accepted, migration)
+		} else {
+			skipped++
+		}
+	}
+
+	verb := "migrated"
+	if opts.DryRun {
+		verb = "would migrate"
+	} else if len(accepted) > 0 {
+		backupDir := opts.BackupDir
+		if backupDir == "" {
+			backupDir = filepath.Join(self.Cachedir, "backups", "migrate-"+time.Now().Format("20060102T150405"))
+		}
+
+		// NB: every backup is written before the first change, if one fails nothing is touched
+		for _, migration := range accepted {
+			err := self.writeMigrationBackup(backupDir, migration.Original)
+			if err != nil {
+				return nil, &CacheError{Op: "backup", Key: migration.Original.EntryInfo.AccountId, Path: backupDir, Err: err}
+			}
+		}
+		fmt.Printf("backed up %d notes to %s\n", len(accepted), backupDir)
+
+		applied := accepted[:0]
+		for _, migration := range accepted {
+			ent := migration.Original.EntryInfo
+			err := self.applyChanges(ent.AccountId, migration.Proposed, migration.Changes)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", ent.AccountNameIncludingPath, err))
+				continue
+			}
+			applied = append(applied, migration)
+		}
+		accepted = applied
+	}
+
+	fmt.Printf("%s %d, skipped %d, %d errors\n", verb, len(accepted), skipped, len(errs))
+
+	return nil, errors.Join(errs...)
+}
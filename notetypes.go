@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The typed notes mirror the templates lpass uses for its built in secure
+// note types.  The lpass tag is the property name as `lpass show` prints it,
+// the cred tag is the StandardCredential field it converts to and from, and
+// secret marks fields whose values are masked (see isSecretField).
+
+type SSHKeyNote struct {
+	BitStrength string `lpass:"Bit Strength"`
+	Format      string `lpass:"Format"`
+	Passphrase  string `lpass:"Passphrase" cred:"Password" secret:"true"`
+	PrivateKey  string `lpass:"Private Key" cred:"Credential" secret:"true"`
+	PublicKey   string `lpass:"Public Key"`
+	Hostname    string `lpass:"Hostname" cred:"Url"`
+	Date        string `lpass:"Date" cred:"IssuedAt"`
+}
+
+type ServerNote struct {
+	Hostname string `lpass:"Hostname" cred:"Url"`
+	Username string `lpass:"Username" cred:"Username"`
+	Password string `lpass:"Password" cred:"Password" secret:"true"`
+}
+
+type DatabaseNote struct {
+	Type     string `lpass:"Type"`
+	Hostname string `lpass:"Hostname" cred:"Url"`
+	Port     string `lpass:"Port"`
+	Database string `lpass:"Database"`
+	Username string `lpass:"Username" cred:"Username"`
+	Password string `lpass:"Password" cred:"Password" secret:"true"`
+	SID      string `lpass:"SID"`
+	Alias    string `lpass:"Alias"`
+}
+
+type CreditCardNote struct {
+	NameOnCard     string `lpass:"Name on Card" cred:"IssuedTo"`
+	Type           string `lpass:"Type"`
+	Number         string `lpass:"Number" cred:"Credential" secret:"true"`
+	SecurityCode   string `lpass:"Security Code" cred:"Password" secret:"true"`
+	StartDate      string `lpass:"Start Date" cred:"IssuedAt"`
+	ExpirationDate string `lpass:"Expiration Date" cred:"ExpiresAt"`
+}
+
+type BankAccountNote struct {
+	BankName      string `lpass:"Bank Name" cred:"IssuedBy"`
+	AccountType   string `lpass:"Account Type"`
+	RoutingNumber string `lpass:"Routing Number"`
+	AccountNumber string `lpass:"Account Number" cred:"Credential" secret:"true"`
+	SWIFTCode     string `lpass:"SWIFT Code"`
+	IBANNumber    string `lpass:"IBAN Number" secret:"true"`
+	Pin           string `lpass:"Pin" cred:"Password" secret:"true"`
+	BranchAddress string `lpass:"Branch Address"`
+	BranchPhone   string `lpass:"Branch Phone"`
+}
+
+type SoftwareLicenseNote struct {
+	LicenseKey       string `lpass:"License Key" cred:"Credential" secret:"true"`
+	Licensee         string `lpass:"Licensee" cred:"IssuedTo"`
+	Version          string `lpass:"Version"`
+	Publisher        string `lpass:"Publisher" cred:"IssuedBy"`
+	SupportEmail     string `lpass:"Support Email"`
+	Website          string `lpass:"Website" cred:"Url"`
+	Price            string `lpass:"Price"`
+	PurchaseDate     string `lpass:"Purchase Date" cred:"IssuedAt"`
+	OrderNumber      string `lpass:"Order Number"`
+	NumberOfLicenses string `lpass:"Number of Licenses"`
+	OrderTotal       string `lpass:"Order Total"`
+}
+
+type AddressNote struct {
+	Title        string `lpass:"Title"`
+	FirstName    string `lpass:"First Name"`
+	MiddleName   string `lpass:"Middle Name"`
+	LastName     string `lpass:"Last Name"`
+	Username     string `lpass:"Username" cred:"Username"`
+	Gender       string `lpass:"Gender"`
+	Birthday     string `lpass:"Birthday"`
+	Company      string `lpass:"Company"`
+	Address1     string `lpass:"Address 1"`
+	Address2     string `lpass:"Address 2"`
+	Address3     string `lpass:"Address 3"`
+	City         string `lpass:"City / Town"`
+	County       string `lpass:"County"`
+	State        string `lpass:"State"`
+	ZipCode      string `lpass:"Zip / Postal Code"`
+	Country      string `lpass:"Country"`
+	Timezone     string `lpass:"Timezone"`
+	EmailAddress string `lpass:"Email Address"`
+	Phone        string `lpass:"Phone"`
+	EveningPhone string `lpass:"Evening Phone"`
+	MobilePhone  string `lpass:"Mobile Phone"`
+	Fax          string `lpass:"Fax"`
+}
+
+type EmailAccountNote struct {
+	Username   string `lpass:"Username" cred:"Username"`
+	Password   string `lpass:"Password" cred:"Password" secret:"true"`
+	Server     string `lpass:"Server" cred:"Url"`
+	Port       string `lpass:"Port"`
+	Type       string `lpass:"Type"`
+	SMTPServer string `lpass:"SMTP Server"`
+	SMTPPort   string `lpass:"SMTP Port"`
+}
+
+type WifiPasswordNote struct {
+	SSID           string `lpass:"SSID" cred:"Username"`
+	Password       string `lpass:"Password" cred:"Password" secret:"true"`
+	ConnectionType string `lpass:"Connection Type"`
+	ConnectionMode string `lpass:"Connection Mode"`
+	Authentication string `lpass:"Authentication"`
+	Encryption     string `lpass:"Encryption"`
+	Use8021X       string `lpass:"Use 802.1X"`
+	FIPSMode       string `lpass:"FIPS Mode"`
+	KeyType        string `lpass:"Key Type"`
+	Protected      string `lpass:"Protected"`
+	KeyIndex       string `lpass:"Key Index"`
+}
+
+type NoteType struct {
+	// Name is the value of the NoteType property, eg: SSH Key
+	Name string
+	// Slug is what `spec --type` takes, eg: ssh-key
+	Slug string
+	// LPassType is what `lpass add --note-type` takes, eg: sshkey
+	LPassType string
+	Type      reflect.Type
+}
+
+var NoteTypes = []*NoteType{
+	{Name: "SSH Key", Slug: "ssh-key", LPassType: "sshkey", Type: reflect.TypeOf(SSHKeyNote{})},
+	{Name: "Server", Slug: "server", LPassType: "server", Type: reflect.TypeOf(ServerNote{})},
+	{Name: "Database", Slug: "database", LPassType: "database", Type: reflect.TypeOf(DatabaseNote{})},
+	{Name: "Credit Card", Slug: "credit-card", LPassType: "credit", Type: reflect.TypeOf(CreditCardNote{})},
+	{Name: "Bank Account", Slug: "bank-account", LPassType: "bank", Type: reflect.TypeOf(BankAccountNote{})},
+	{Name: "Software License", Slug: "software-license", LPassType: "softwarelicense", Type: reflect.TypeOf(SoftwareLicenseNote{})},
+	{Name: "Address", Slug: "address", LPassType: "address", Type: reflect.TypeOf(AddressNote{})},
+	{Name: "Email Account", Slug: "email-account", LPassType: "email", Type: reflect.TypeOf(EmailAccountNote{})},
+	{Name: "Wi-Fi Password", Slug: "wifi-password", LPassType: "wifi", Type: reflect.TypeOf(WifiPasswordNote{})},
+}
+
+// LookupNoteType finds a note type by its Name, Slug or LPassType
+func LookupNoteType(name string) *NoteType {
+	for _, nt := range NoteTypes {
+		if strings.EqualFold(name, nt.Name) || name == nt.Slug || name == nt.LPassType {
+			return nt
+		}
+	}
+
+	return nil
+}
+
+func NoteTypeSlugs() []string {
+	slugs := make([]string, 0)
+	for _, nt := range NoteTypes {
+		slugs = append(slugs, nt.Slug)
+	}
+	sort.Strings(slugs)
+	return slugs
+}
+
+// noteTypeSecretFields are the property names tagged secret in any note type
+var noteTypeSecretFields = func() map[string]bool {
+	secrets := make(map[string]bool)
+	for _, nt := range NoteTypes {
+		for idx := 0; idx < nt.Type.NumField(); idx++ {
+			if nt.Type.Field(idx).Tag.Get("secret") == "true" {
+				secrets[nt.Type.Field(idx).Tag.Get("lpass")] = true
+			}
+		}
+	}
+	return secrets
+}()
+
+// New returns a pointer to a new typed note, eg: *SSHKeyNote
+func (self *NoteType) New() interface{} {
+	return reflect.New(self.Type).Interface()
+}
+
+// PropertyNames are the lpass property names of the type, in template order
+func (self *NoteType) PropertyNames() []string {
+	names := make([]string, 0)
+	for idx := 0; idx < self.Type.NumField(); idx++ {
+		names = append(names, self.Type.Field(idx).Tag.Get("lpass"))
+	}
+	return names
+}
+
+// FromProperties fills a new typed note from a note's Properties
+func (self *NoteType) FromProperties(props map[string]string) interface{} {
+	typed := self.New()
+	val := reflect.ValueOf(typed).Elem()
+	for idx := 0; idx < self.Type.NumField(); idx++ {
+		val.Field(idx).SetString(props[self.Type.Field(idx).Tag.Get("lpass")])
+	}
+	return typed
+}
+
+// ToProperties is the inverse of FromProperties, empty values are left out
+func (self *NoteType) ToProperties(typed interface{}) map[string]string {
+	props := map[string]string{"NoteType": self.Name}
+	val := reflect.Indirect(reflect.ValueOf(typed))
+	for idx := 0; idx < self.Type.NumField(); idx++ {
+		if s := val.Field(idx).String(); s != "" {
+			props[self.Type.Field(idx).Tag.Get("lpass")] = s
+		}
+	}
+	return props
+}
+
+// ToStandardCredential copies the fields with a cred tag into a StandardCredential
+func (self *NoteType) ToStandardCredential(typed interface{}) *StandardCredential {
+	cred := &StandardCredential{}
+	src := reflect.Indirect(reflect.ValueOf(typed))
+	dst := reflect.ValueOf(cred).Elem()
+	for idx := 0; idx < self.Type.NumField(); idx++ {
+		if name := self.Type.Field(idx).Tag.Get("cred"); name != "" {
+			dst.FieldByName(name).SetString(src.Field(idx).String())
+		}
+	}
+	return cred
+}
+
+// FromStandardCredential is the inverse of ToStandardCredential
+func (self *NoteType) FromStandardCredential(cred *StandardCredential) interface{} {
+	typed := self.New()
+	src := reflect.ValueOf(cred).Elem()
+	dst := reflect.ValueOf(typed).Elem()
+	for idx := 0; idx < self.Type.NumField(); idx++ {
+		if name := self.Type.Field(idx).Tag.Get("cred"); name != "" {
+			dst.Field(idx).SetString(src.FieldByName(name).String())
+		}
+	}
+	return typed
+}
+
+// NoteType is nil for generic and custom (Custom_<id>) note types
+func (self *LPassSecureNote) NoteType() *NoteType {
+	if self.Properties == nil || self.Properties["NoteType"] == "" {
+		return nil
+	}
+
+	return LookupNoteType(self.Properties["NoteType"])
+}
+
+// LPassType is the --note-type to add the note with, "" for a generic note
+func (self *LPassSecureNote) LPassType() string {
+	if nt := self.NoteType(); nt != nil {
+		return nt.LPassType
+	}
+
+	return ""
+}
+
+// rebuildViews refreshes Credential, Typed and Certificates, the read only
+// views of the Properties and Notes
+func (self *LPassSecureNote) rebuildViews() {
+	certs, certWarnings := DecodeCertificates(self.Properties)
+	self.Certificates = certs
+	self.Credential, self.CredentialSources, self.CredentialWarnings = BuildStandardCredential(self)
+	self.CredentialWarnings = append(self.CredentialWarnings, certWarnings...)
+
+	self.Typed = nil
+	if nt := self.NoteType(); nt != nil {
+		self.Typed = nt.FromProperties(self.Properties)
+	}
+}
+
+func unknownNoteTypeError(name string) error {
+	return fmt.Errorf("Error: unknown note type '%s', expected one of: %s", name, strings.Join(NoteTypeSlugs(), ", "))
+}
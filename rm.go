@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+func (self *LPassEntry) Matches(pattern string) bool {
+	fullName := strings.TrimPrefix(self.AccountNameIncludingPath, "(none)/")
+
+	if pattern == self.AccountId || pattern == self.AccountNameIncludingPath || pattern == fullName || pattern == self.AccountName {
+		return true
+	}
+
+	if !isGlob(pattern) {
+		return false
+	}
+
+	for _, name := range []string{self.AccountNameIncludingPath, fullName, self.AccountName} {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ResolveEntries finds the entries matching any of the ids, names or globs
+func (self *LPass) ResolveEntries(patterns []string) ([]*LPassEntry, error) {
+	entries, err := self.GetList([]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %s", pattern, err)
+		}
+	}
+
+	matches := make([]*LPassEntry, 0)
+	for _, entry := range entries {
+		for _, pattern := range patterns {
+			if entry.Matches(pattern) {
+				matches = append(matches, entry)
+				break
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w: nothing matches %q", ErrEntryNotFound, patterns)
+	}
+
+	return matches, nil
+}
+
+func (self *LPass) removeLocalCredential(entry *LPassEntry) error {
+	return self.removeLocalFile(entry.ToPath(self.CredentialsFolder))
+}
+
+// removeLocalFile removes a credential file and any now empty parent
+// folders inside the CredentialsFolder
+func (self *LPass) removeLocalFile(fname string) error {
+	err := os.Remove(fname)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	root := filepath.Clean(self.CredentialsFolder)
+	for dname := filepath.Dir(fname); dname != root && strings.HasPrefix(dname, root); dname = filepath.Dir(dname) {
+		if os.Remove(dname) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// forgetSyncedDown drops removed entries from the SyncDown manifest and the
+// search index, otherwise sync-down reports them as no longer in lastpass
+func (self *LPass) forgetSyncedDown(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	manifest, err := self.readSyncDownManifest()
+	if err != nil {
+		return err
+	}
+
+	if len(manifest) > 0 {
+		for _, id := range ids {
+			delete(manifest, id)
+		}
+
+		err = self.writeSyncDownManifest(manifest)
+		if err != nil {
+			return err
+		}
+	}
+
+	// NB: an unreadable index is rebuilt by the next sync-down
+	index, err := self.readSearchIndex()
+	if err != nil || index == nil {
+		return nil
+	}
+
+	for _, id := range ids {
+		index.Remove(id)
+	}
+
+	return self.writeSearchIndex(index)
+}
+
+type RemoveOptions struct {
+	Yes    bool
+	DryRun bool
+}
+
+func (self *LPass) Remove(args []string, opts RemoveOptions) (cmd *exec.Cmd, err error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("Error: you must supply a ID, name or glob")
+	}
+
+	entries, err := self.ResolveEntries(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		fmt.Printf("Would remove %d entries:\n", len(entries))
+	} else {
+		fmt.Printf("Removing %d entries:\n", len(entries))
+	}
+	for _, entry := range entries {
+		fmt.Printf("  %s  %s\n", entry.AccountId, entry.AccountNameIncludingPath)
+	}
+
+	if opts.DryRun {
+		return nil, nil
+	}
+
+	if !opts.Yes && !self.confirm(fmt.Sprintf("Remove these %d entries from lastpass?", len(entries))) {
+		fmt.Printf("Aborted.\n")
+		return nil, nil
+	}
+
+	// NB: the cached list is stale as soon as anything has been removed,
+	// even if a later removal fails
+	removed := make([]string, 0)
+	defer func() {
+		err = errors.Join(err, self.forgetSyncedDown(removed), self.cacheInvalidate(listCacheKey))
+	}()
+
+	for _, entry := range entries {
+		err = self.backend().Remove(entry.AccountId)
+		if err != nil {
+			return nil, err
+		}
+
+		err = self.removeLocalCredential(entry)
+		if err != nil {
+			return nil, err
+		}
+		removed = append(removed, entry.AccountId)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLPassEntryMatches(t *testing.T) {
+	ent := &LPassEntry{
+		AccountId:                "3172274455914884164282",
+		AccountName:              "deploy-key",
+		AccountNameIncludingPath: "Shared-Infra/aws/deploy-key",
+	}
+
+	for _, pattern := range []string{"3172274455914884164282", "deploy-key", "Shared-Infra/aws/deploy-key", "Shared-Infra/*/*", "deploy-*"} {
+		if !ent.Matches(pattern) {
+			t.Errorf("Error: expected '%s' to match %s", pattern, ent.AccountNameIncludingPath)
+		}
+	}
+
+	for _, pattern := range []string{"deploy", "Shared-Infra/*", "31722744559148841642"} {
+		if ent.Matches(pattern) {
+			t.Errorf("Error: expected '%s' not to match %s", pattern, ent.AccountNameIncludingPath)
+		}
+	}
+}
+
+func TestRemoveWithConfirmation(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+
+	captureStdout(t, func() {
+		lpass.SyncToLocal([]string{}, SyncDownOptions{})
+	})
+
+	fname := filepath.Join(lpass.CredentialsFolder, "Shared-Infra", "aws", "deploy-key", "credential.json")
+	if !FileExists(fname) {
+		t.Fatalf("Error: expected sync-down to write %s", fname)
+	}
+
+	lpass.Stdin = strings.NewReader("y\n")
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Remove([]string{"Shared-Infra/*/*"}, RemoveOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output, "3172274455914884164282  Shared-Infra/aws/deploy-key") {
+		t.Errorf("Error: expected rm to list what it removes, got:\n%s", output)
+	}
+
+	if fake.Find("3172274455914884164282") != nil || len(fake.Mutations) != 1 {
+		t.Errorf("Error: expected deploy-key to be removed, got %+v", fake.Mutations)
+	}
+
+	if FileExists(fname) || FileExists(filepath.Join(lpass.CredentialsFolder, "Shared-Infra")) {
+		t.Errorf("Error: expected %s and its empty folders to be removed", fname)
+	}
+
+	if !FileExists(filepath.Join(lpass.CredentialsFolder, "-none-", "tivo.com", "credential.json")) {
+		t.Error("Error: expected the other credentials to be left alone")
+	}
+
+	entries, err := lpass.GetList([]string{})
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Error: expected the list cache to be invalidated, got %d entries / %v", len(entries), err)
+	}
+}
+
+func TestRemoveDeclined(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	lpass.Stdin = strings.NewReader("n\n")
+
+	captureStdout(t, func() {
+		_, err := lpass.Remove([]string{"tivo.com"}, RemoveOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if len(fake.Mutations) != 0 {
+		t.Errorf("Error: expected nothing to be removed, got %+v", fake.Mutations)
+	}
+}
+
+func TestRemoveDryRun(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+
+	output := captureStdout(t, func() {
+		_, err := lpass.Remove([]string{"*"}, RemoveOptions{DryRun: true, Yes: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if !strings.Contains(output, "Would remove 3 entries") || len(fake.Mutations) != 0 {
+		t.Errorf("Error: expected a dry run of 3 entries, got %+v\n%s", fake.Mutations, output)
+	}
+}
+
+func TestRemoveYes(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+
+	captureStdout(t, func() {
+		_, err := lpass.Remove([]string{"tivo.com", "4281390154665116890"}, RemoveOptions{Yes: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if len(fake.Entries) != 1 {
+		t.Errorf("Error: expected 2 entries to be removed, got %+v", fake.Mutations)
+	}
+}
+
+func TestRemoveNoMatches(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	_, err := lpass.Remove([]string{"no-such-*"}, RemoveOptions{Yes: true})
+	if !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Error: expected ErrEntryNotFound, got %v", err)
+	}
+}
+
+func TestRemoveFailureStillInvalidatesTheList(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	fake.RemoveErrors = map[string]error{"5926414273882541009": errors.New("Error: network is down")}
+
+	var err error
+	captureStdout(t, func() {
+		_, err = lpass.Remove([]string{"tivo.com", "4281390154665116890"}, RemoveOptions{Yes: true})
+	})
+	if err == nil || !strings.Contains(err.Error(), "network is down") {
+		t.Fatalf("Error: expected the removal of tivo.com to fail, got %v", err)
+	}
+
+	if len(fake.Mutations) != 1 || fake.Mutations[0].Id != "4281390154665116890" {
+		t.Fatalf("Error: expected only Test Note for Notes to be removed, got %+v", fake.Mutations)
+	}
+
+	if FileExists(filepath.Join(lpass.Cachedir, listCacheKey)) {
+		t.Errorf("Error: expected the cached list to be invalidated after a partial removal")
+	}
+}
+
+func TestRemoveForgetsSyncedDownEntries(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	output := captureStdout(t, func() {
+		_, err := lpass.SyncToLocal([]string{}, SyncDownOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = lpass.Remove([]string{"tivo.com"}, RemoveOptions{Yes: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = lpass.SyncToLocal([]string{}, SyncDownOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if strings.Contains(output, "no longer in lastpass") || !strings.Contains(output, "done, 0 added, 0 changed, 0 removed, 2 unchanged, 0 errors.") {
+		t.Errorf("Error: expected the second sync-down to know tivo.com was removed, got:\n%s", output)
+	}
+
+	index, err := lpass.readSearchIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if index.Has("5926414273882541009") {
+		t.Errorf("Error: expected tivo.com to be removed from the search index")
+	}
+}
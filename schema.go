@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// NB: bump the version whenever a change to StandardCredential would make
+// a previously valid note invalid (a new required field, a new format, ...)
+const StandardCredentialSchemaVersion = 2
+
+type SchemaProperty struct {
+	Name     string
+	Required bool
+	Format   string
+}
+
+// StandardCredentialSchema is generated from the schema tags on StandardCredential
+func StandardCredentialSchema() []*SchemaProperty {
+	props := make([]*SchemaProperty, 0)
+	typ := reflect.TypeOf(StandardCredential{})
+
+	for idx := 0; idx < typ.NumField(); idx++ {
+		prop := &SchemaProperty{Name: typ.Field(idx).Name}
+		for _, opt := range strings.Split(typ.Field(idx).Tag.Get("schema"), ",") {
+			switch {
+			case opt == "required":
+				prop.Required = true
+			case strings.HasPrefix(opt, "format="):
+				prop.Format = strings.TrimPrefix(opt, "format=")
+			}
+		}
+		props = append(props, prop)
+	}
+
+	return props
+}
+
+// StandardCredentialJsonSchema renders the schema as a JSON Schema document
+func StandardCredentialJsonSchema() map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+
+	for _, prop := range StandardCredentialSchema() {
+		p := map[string]interface{}{"type": "string"}
+		switch prop.Format {
+		case "":
+		case "date":
+			// NB: json schema's date and date-time formats are stricter than parseCredentialTime
+			p["type"] = []string{"string", "number"}
+			p["description"] = "a date (YYYY-MM-DD), a date and time (RFC3339) or a unix timestamp"
+		default:
+			p["format"] = prop.Format
+		}
+		if prop.Required {
+			p["minLength"] = 1
+			required = append(required, prop.Name)
+		}
+		properties[prop.Name] = p
+	}
+
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         fmt.Sprintf("https://github.com/kyleburton/rlpass/schema/standard-credential/v%d.json", StandardCredentialSchemaVersion),
+		"title":       "StandardCredential",
+		"description": "The Notes json of a lastpass entry managed by rlpass, keys starting with _ are comments",
+		"type":        "object",
+		"properties":  properties,
+		"required":    required,
+		// NB: _comments are allowed, anything else unknown is a mistake
+		"patternProperties":    map[string]interface{}{"^_": map[string]interface{}{}},
+		"additionalProperties": false,
+	}
+}
+
+type SchemaViolation struct {
+	Field string
+	Msg   string
+}
+
+func (self *SchemaViolation) String() string {
+	if self.Field == "" {
+		return self.Msg
+	}
+
+	return self.Field + ": " + self.Msg
+}
+
+// ValidateNotes checks a note's Notes against StandardCredentialSchema,
+// reporting every problem rather than stopping at the first
+func ValidateNotes(note *LPassSecureNote) []*SchemaViolation {
+	violations := make([]*SchemaViolation, 0)
+
+	// NB: ParseShow falls back to {} when the Notes aren't json, don't let that pass
+	if note.notesErr != nil {
+		return append(violations, &SchemaViolation{Field: "Notes", Msg: fmt.Sprintf("is not json: %s", note.notesErr)})
+	}
+
+	if note.Notes == nil {
+		return append(violations, &SchemaViolation{Field: "Notes", Msg: "is missing"})
+	}
+
+	fields, ok := note.Notes.(map[string]interface{})
+	if !ok {
+		return append(violations, &SchemaViolation{Field: "Notes", Msg: fmt.Sprintf("expected a json object, got %T", note.Notes)})
+	}
+
+	schema := make(map[string]*SchemaProperty)
+	for _, prop := range StandardCredentialSchema() {
+		schema[prop.Name] = prop
+
+		val, present := fields[prop.Name]
+		s, isString := val.(string)
+		_, isNumber := val.(float64)
+		switch {
+		case isNumber && prop.Format == "date":
+			continue
+		case present && val != nil && !isString:
+			violations = append(violations, &SchemaViolation{Field: prop.Name, Msg: fmt.Sprintf("expected a string, got %T", val)})
+		case prop.Required && s == "":
+			violations = append(violations, &SchemaViolation{Field: prop.Name, Msg: "is required"})
+		case s != "" && prop.Format == "uri" && !isUri(s):
+			violations = append(violations, &SchemaViolation{Field: prop.Name, Msg: fmt.Sprintf("'%s' is not a url", s)})
+		case s != "" && prop.Format == "date":
+			if _, _, err := parseCredentialTime(s); err != nil {
+				violations = append(violations, &SchemaViolation{Field: prop.Name, Msg: err.Error()})
+			}
+		}
+	}
+
+	keys := make([]string, 0)
+	for k := range fields {
+		if _, known := schema[k]; !known && !strings.HasPrefix(k, "_") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		violations = append(violations, &SchemaViolation{Field: k, Msg: "unknown field"})
+	}
+
+	return violations
+}
+
+func isUri(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "")
+}
+
+type ValidateOptions struct {
+	All    bool
+	Schema bool
+}
+
+// Validate checks entries (by id or name), local json files or, with
+// --all, every entry against the StandardCredential schema
+func (self *LPass) Validate(args []string, opts ValidateOptions) (*exec.Cmd, error) {
+	if opts.Schema {
+		b, err := json.MarshalIndent(StandardCredentialJsonSchema(), "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println(string(b))
+		return nil, nil
+	}
+
+	if !opts.All && len(args) == 0 {
+		return nil, fmt.Errorf("Error: you must supply an ID, name, json file or --all")
+	}
+
+	type target struct {
+		label string
+		note  *LPassSecureNote
+		err   error
+	}
+	targets := make([]*target, 0)
+
+	if opts.All {
+		entries, err := self.GetList([]string{})
+		if err != nil {
+			return nil, err
+		}
+
+		notes, errs := self.FetchSecureNotes(entries, 4)
+		for ii, entry := range entries {
+			targets = append(targets, &target{label: entry.AccountNameIncludingPath, note: notes[ii], err: errs[ii]})
+		}
+	}
+
+	for _, arg := range args {
+		if FileExists(arg) {
+			data, err := self.readJsonInput([]string{arg})
+			if err == nil {
+				var note *LPassSecureNote
+				note, err = ParseSecureNoteJson(data)
+				targets = append(targets, &target{label: arg, note: note, err: err})
+				continue
+			}
+			targets = append(targets, &target{label: arg, err: err})
+			continue
+		}
+
+		note, err := self.GetSecureNote(arg)
+		targets = append(targets, &target{label: arg, note: note, err: err})
+	}
+
+	invalid := 0
+	var errs []error
+	for _, t := range targets {
+		if t.err != nil {
+			fmt.Printf("error   %s: %s\n", t.label, t.err)
+			errs = append(errs, fmt.Errorf("%s: %w", t.label, t.err))
+			continue
+		}
+
+		violations := ValidateNotes(t.note)
+		if len(violations) == 0 {
+			fmt.Printf("ok      %s\n", t.label)
+			continue
+		}
+
+		invalid++
+		fmt.Printf("invalid %s\n", t.label)
+		for _, v := range violations {
+			fmt.Printf("    %s\n", v)
+		}
+	}
+
+	fmt.Printf("%d checked, %d invalid, %d errors (schema v%d)\n", len(targets), invalid, len(errs), StandardCredentialSchemaVersion)
+
+	if invalid > 0 {
+		errs = append(errs, &ValidationError{Msg: fmt.Sprintf("%d entries don't match the StandardCredential schema", invalid)})
+	}
+
+	return nil, errors.Join(errs...)
+}
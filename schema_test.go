@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStandardCredentialJsonSchema(t *testing.T) {
+	b, err := json.Marshal(StandardCredentialJsonSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Id         string `json:"$id"`
+		Properties map[string]map[string]interface{}
+		Required   []string
+	}
+	err = json.Unmarshal(b, &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(schema.Id, "/v2.json") {
+		t.Errorf("Error: expected a versioned $id, got '%s'", schema.Id)
+	}
+
+	if len(schema.Properties) != 15 || schema.Properties["Url"]["format"] != "uri" {
+		t.Errorf("Error: expected every StandardCredential field in the schema, got %+v", schema.Properties)
+	}
+
+	if strings.Join(schema.Required, ",") != "Name,Owner" {
+		t.Errorf("Error: expected Name and Owner to be required, got %q", schema.Required)
+	}
+}
+
+func TestValidateNotes(t *testing.T) {
+	for notes, expected := range map[string]string{
+		`{"Name": "x", "Owner": "infra", "_comment": "ignored"}`: "",
+		`{"Name": "x"}`: "Owner: is required",
+		`{"Name": "x", "Owner": "", "Url": "not a url"}`:                    "Owner: is required; Url: 'not a url' is not a url",
+		`{"Name": "x", "Owner": "infra", "Colour": "blue", "Size": 3}`:      "Colour: unknown field; Size: unknown field",
+		`{"Name": "x", "Owner": 7}`:                                         "Owner: expected a string, got float64",
+		`{"Name": "x", "Owner": "i", "ProjectUrl": "https://example.com/"}`: "",
+		`["Name"]`: "Notes: expected a json object, got []interface {}",
+		`null`:     "Notes: is missing",
+		`{"Name": "x", "Owner": "i", "ExpiresAt": "next tuesday"}`:                       "ExpiresAt: 'next tuesday' is not a date, expected YYYY-MM-DD or RFC3339",
+		`{"Name": "x", "Owner": "i", "IssuedAt": 1700000000, "ExpiresAt": "2027-01-01"}`: "",
+		`{"Name": "x", "Owner": "i", "LastRotatedAt": true}`:                             "LastRotatedAt: expected a string, got bool",
+	} {
+		note, err := ParseSecureNoteJson([]byte(`{"Notes": ` + notes + `}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msgs := make([]string, 0)
+		for _, v := range ValidateNotes(note) {
+			msgs = append(msgs, v.String())
+		}
+
+		if strings.Join(msgs, "; ") != expected {
+			t.Errorf("Error: validating %s, expected '%s', got '%s'", notes, expected, strings.Join(msgs, "; "))
+		}
+	}
+}
+
+func TestValidateAll(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	ent := fake.Find("Test Note for Notes")
+	ent.Set("Notes", `{"Name": "Test Note for Notes", "Colour": "blue"}`)
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Validate([]string{}, ValidateOptions{All: true})
+	})
+
+	if ExitCodeFor(err) != ExitCodeInvalid {
+		t.Errorf("Error: expected the invalid exit code, got %d / %v", ExitCodeFor(err), err)
+	}
+
+	for _, expected := range []string{
+		"ok      Shared-Infra/aws/deploy-key",
+		"invalid Test/Test Note for Notes\n    Owner: is required\n    Colour: unknown field",
+		"invalid (none)/tivo.com\n    Notes: is missing",
+		"3 checked, 2 invalid, 0 errors (schema v2)",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Error: expected validate to report '%s', got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestValidateFileAndEntry(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	fname := filepath.Join(t.TempDir(), "note.json")
+	err := ioutil.WriteFile(fname, []byte(addNoteJson), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureStdout(t, func() {
+		_, err = lpass.Validate([]string{fname, "deploy-key"}, ValidateOptions{})
+	})
+	if err != nil {
+		t.Fatalf("Error: expected both to be valid, got %v:\n%s", err, output)
+	}
+
+	_, err = lpass.Validate([]string{}, ValidateOptions{})
+	if err == nil {
+		t.Errorf("Error: expected validate without arguments to fail")
+	}
+}
+
+func TestAddRejectsSchemaViolations(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	lpass.Stdin = strings.NewReader(`{"EntryInfo": {"path": "Test/x"}, "Notes": {"Name": "x", "Url": "example"}}`)
+
+	_, err := lpass.Add([]string{})
+	if ExitCodeFor(err) != ExitCodeInvalid || !strings.Contains(err.Error(), "Owner: is required; Url: 'example' is not a url") {
+		t.Errorf("Error: expected add to report every violation, got %v", err)
+	}
+
+	if len(fake.Mutations) != 0 {
+		t.Errorf("Error: expected nothing to be added, got %+v", fake.Mutations)
+	}
+}
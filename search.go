@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SearchTerm is one word of a search query: an optional field scope
+// (eg: url:github.com) and a case insensitive substring or /regex/
+type SearchTerm struct {
+	Field  string
+	Text   string
+	Regexp *regexp.Regexp
+}
+
+type SearchQuery []*SearchTerm
+
+func ParseSearchQuery(args []string) (SearchQuery, error) {
+	query := make(SearchQuery, 0)
+
+	for _, word := range strings.Fields(strings.Join(args, " ")) {
+		term := &SearchTerm{Text: word}
+
+		// NB: a leading / is a regex, even if it contains a ':'
+		if pos := strings.Index(word, ":"); pos > 0 && !strings.HasPrefix(word, "/") {
+			term.Field, term.Text = word[:pos], word[pos+1:]
+		}
+
+		if len(term.Text) > 1 && strings.HasPrefix(term.Text, "/") && strings.HasSuffix(term.Text, "/") {
+			re, err := regexp.Compile("(?i)" + term.Text[1:len(term.Text)-1])
+			if err != nil {
+				return nil, fmt.Errorf("Error: invalid regex '%s': %s", term.Text, err)
+			}
+			term.Regexp = re
+		}
+
+		query = append(query, term)
+	}
+
+	if len(query) == 0 {
+		return nil, fmt.Errorf("Error: you must supply something to search for")
+	}
+
+	return query, nil
+}
+
+func (self *SearchTerm) matchesText(s string) bool {
+	if self.Regexp != nil {
+		return self.Regexp.MatchString(s)
+	}
+
+	return strings.Contains(strings.ToLower(s), strings.ToLower(self.Text))
+}
+
+// matchesField is true if the term is scoped to the field, either by its
+// full name (notes.owner) or its last component (owner)
+func (self *SearchTerm) matchesField(field string) bool {
+	scope := strings.ToLower(self.Field)
+	field = strings.ToLower(field)
+
+	if scope == "path" {
+		scope = "name"
+	}
+
+	return scope == field || scope == field[strings.LastIndex(field, ".")+1:]
+}
+
+// Match returns the fields matched by every term of the query, or nil if
+// any term doesn't match.  Only the values of public fields (see
+// isPublicField) are searched and shown, unless showSecrets is set, a
+// match on the name of any other field shows it masked.
+func (self SearchQuery) Match(fields map[string]string, showSecrets bool) map[string]string {
+	matches := make(map[string]string)
+
+	for _, term := range self {
+		found := false
+		for field, val := range fields {
+			// NB: matching a secret, even without showing it, would leak it a query at a time
+			visible := showSecrets || isPublicField(field)
+
+			if term.Field != "" {
+				if !term.matchesField(field) || !visible || !term.matchesText(val) {
+					continue
+				}
+			} else {
+				keyMatches := term.matchesText(strings.TrimPrefix(field, "Notes."))
+				valMatches := visible && term.matchesText(val)
+				if !keyMatches && !valMatches {
+					continue
+				}
+			}
+
+			found = true
+			if !visible {
+				val = "********"
+			}
+			matches[field] = val
+		}
+
+		if !found {
+			return nil
+		}
+	}
+
+	return matches
+}
+
+func flattenSearchFields(prefix string, val interface{}, fields map[string]string) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for k, vv := range v {
+			flattenSearchFields(prefix+"."+k, vv, fields)
+		}
+	case []interface{}:
+		for ii, vv := range v {
+			flattenSearchFields(fmt.Sprintf("%s.%d", prefix, ii), vv, fields)
+		}
+	case string:
+		fields[prefix] = v
+	case nil:
+		fields[prefix] = ""
+	default:
+		b, _ := json.Marshal(v)
+		fields[prefix] = string(b)
+	}
+}
+
+// SearchFields flattens a note into the fields search looks at: its id and
+// name, its properties and everything in its Notes json (eg: Notes.Owner)
+func (self *LPassSecureNote) SearchFields() map[string]string {
+	fields := make(map[string]string)
+
+	if self.EntryInfo != nil {
+		fields["Id"] = self.EntryInfo.AccountId
+		fields["Name"] = self.EntryInfo.AccountNameIncludingPath
+	}
+
+	for k, v := range self.Properties {
+		fields[k] = v
+	}
+
+	if self.Notes != nil {
+		flattenSearchFields("Notes", self.Notes, fields)
+	} else if self.RawNotes != "" {
+		fields["Notes"] = self.RawNotes
+	}
+
+	return fields
+}
+
+type SearchResult struct {
+	Id      string            `json:"id"`
+	Path    string            `json:"path"`
+	Matches map[string]string `json:"matches"`
+}
+
+type SearchOptions struct {
+	ShowSecrets bool
+	Offline     bool
+	Parallel    int
+}
+
+// Search returns the documents (see SearchFields) matching the query
+func (self SearchQuery) Search(docs []map[string]string, showSecrets bool) []*SearchResult {
+	results := make([]*SearchResult, 0)
+
+	for _, fields := range docs {
+		matches := self.Match(fields, showSecrets)
+		if matches == nil {
+			continue
+		}
+
+		results = append(results, &SearchResult{Id: fields["Id"], Path: fields["Name"], Matches: matches})
+	}
+
+	sort.SliceStable(results, func(ii, jj int) bool {
+		return results[ii].Path < results[jj].Path
+	})
+
+	return results
+}
+
+func (self *LPass) searchDocuments(parallel int) ([]map[string]string, error) {
+	entries, err := self.GetList([]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	notes, errs := self.FetchSecureNotes(entries, parallel)
+	docs := make([]map[string]string, 0)
+	for ii, note := range notes {
+		if errs[ii] != nil {
+			return nil, fmt.Errorf("%s: %w", entries[ii].AccountNameIncludingPath, errs[ii])
+		}
+		docs = append(docs, note.SearchFields())
+	}
+
+	return docs, nil
+}
+
+func (self *LPass) offlineSearchDocuments() ([]map[string]string, error) {
+	index, err := self.readSearchIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	if index == nil {
+		return nil, fmt.Errorf("Error: there is no offline search index yet, run sync-down first")
+	}
+
+	docs := make([]map[string]string, 0)
+	for _, id := range index.Ids() {
+		if self.Filter.Matches(index.Entries[id].Entry) {
+			docs = append(docs, index.Entries[id].Fields)
+		}
+	}
+
+	return docs, nil
+}
+
+// Search fetches every entry (that passes self.Filter), or reads them from
+// the offline index, and emits the ones matching all of the query terms as json
+func (self *LPass) Search(args []string, opts SearchOptions) (*exec.Cmd, error) {
+	query, err := ParseSearchQuery(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []map[string]string
+	if opts.Offline {
+		docs, err = self.offlineSearchDocuments()
+	} else {
+		docs, err = self.searchDocuments(opts.Parallel)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.MarshalIndent(query.Search(docs, opts.ShowSecrets), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println(string(b))
+
+	return nil, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	query, err := ParseSearchQuery([]string{"url:github.com owner:platform", "/^deploy-/", "path:/a|b/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(query) != 4 {
+		t.Fatalf("Error: expected 4 terms, got %d", len(query))
+	}
+
+	if query[0].Field != "url" || query[0].Text != "github.com" || query[1].Field != "owner" {
+		t.Errorf("Error: expected field scoped terms, got %+v %+v", query[0], query[1])
+	}
+
+	if query[2].Field != "" || query[2].Regexp == nil || query[3].Field != "path" || query[3].Regexp == nil {
+		t.Errorf("Error: expected regex terms, got %+v %+v", query[2], query[3])
+	}
+
+	for _, args := range [][]string{{}, {" "}, {"/[a-/"}} {
+		if _, err := ParseSearchQuery(args); err == nil {
+			t.Errorf("Error: expected %q to be rejected", args)
+		}
+	}
+}
+
+func TestSearchQueryMatch(t *testing.T) {
+	fields := map[string]string{
+		"Name":              "Shared-Infra/aws/deploy-key",
+		"Username":          "deploy",
+		"Password":          "hunter2",
+		"URL":               "https://github.com/kyleburton",
+		"Notes.Owner":       "platform",
+		"Notes.Links.0":     "https://wiki/deploy",
+		"Notes.Private Key": "-----BEGIN",
+	}
+
+	for _, tc := range []struct {
+		query    string
+		expected []string
+	}{
+		{"url:github.com owner:platform", []string{"Notes.Owner", "URL"}},
+		{"OWNER:Platform", []string{"Notes.Owner"}},
+		{"notes.links.0:wiki", nil},
+		{"/^Shared-.*key$/", []string{"Name"}},
+		{"links", []string{"Notes.Links.0"}},
+		{"hunter2", nil},
+		{"password:hunter2", nil},
+		{"password:/^hun/", nil},
+		{"url:gitlab", nil},
+		{"deploy owner:nobody", nil},
+	} {
+		query, err := ParseSearchQuery([]string{tc.query})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		matches := query.Match(fields, false)
+		if tc.expected == nil {
+			if matches != nil {
+				t.Errorf("Error: expected '%s' not to match, got %+v", tc.query, matches)
+			}
+			continue
+		}
+
+		if len(matches) != len(tc.expected) {
+			t.Errorf("Error: expected '%s' to match %q, got %+v", tc.query, tc.expected, matches)
+		}
+		for _, field := range tc.expected {
+			if _, ok := matches[field]; !ok {
+				t.Errorf("Error: expected '%s' to match %s, got %+v", tc.query, field, matches)
+			}
+		}
+	}
+}
+
+func TestSearchMasksSecrets(t *testing.T) {
+	fields := map[string]string{
+		"Name":         "github",
+		"Password":     "hunter2",
+		"API Token":    "ghp_supersecretgithub",
+		"Notes.apikey": "sk_live_abc",
+	}
+
+	query, _ := ParseSearchQuery([]string{"github"})
+	if matches := query.Match(fields, false); matches["Name"] != "github" || len(matches) != 1 {
+		t.Errorf("Error: expected only the Name to match, got %+v", matches)
+	}
+
+	for _, q := range []string{"sk_live", "password:hunter", "notes.apikey:/^sk_/"} {
+		query, _ = ParseSearchQuery([]string{q})
+		if matches := query.Match(fields, false); matches != nil {
+			t.Errorf("Error: expected '%s' not to search secret values, got %+v", q, matches)
+		}
+	}
+
+	query, _ = ParseSearchQuery([]string{"apikey"})
+	if matches := query.Match(fields, false); matches["Notes.apikey"] != "********" {
+		t.Errorf("Error: expected a match on the field name to be masked, got %+v", matches)
+	}
+
+	query, _ = ParseSearchQuery([]string{"hunter"})
+	if matches := query.Match(fields, true); matches["Password"] != "hunter2" {
+		t.Errorf("Error: expected --show-secrets to search and show the password, got %+v", matches)
+	}
+}
+
+func TestSearchCommand(t *testing.T) {
+	lpass, _ := newFakeLPass(t, "basic")
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Search([]string{"owner:infra"}, SearchOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results []*SearchResult
+	err = json.Unmarshal([]byte(output), &results)
+	if err != nil {
+		t.Fatalf("Error: expected json output, got %s: %s", err, output)
+	}
+
+	if len(results) != 1 || results[0].Path != "Shared-Infra/aws/deploy-key" || results[0].Matches["Notes.Owner"] != "infra" {
+		t.Errorf("Error: expected deploy-key to be found, got %s", output)
+	}
+
+	output = captureStdout(t, func() {
+		_, err = lpass.Search([]string{"deploy"}, SearchOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(output, "l0ew0i1fkhxas5s9yf8n8z5v0v2l") {
+		t.Errorf("Error: expected search not to show the password, got %s", output)
+	}
+}
@@ -0,0 +1,692 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+type LocalCredential struct {
+	Path string
+	Data []byte
+	Note *LPassSecureNote
+}
+
+// ReadLocalCredentials finds every credential.json in the CredentialsFolder
+func (self *LPass) ReadLocalCredentials() ([]*LocalCredential, error) {
+	creds := make([]*LocalCredential, 0)
+
+	err := filepath.Walk(self.CredentialsFolder, func(fname string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || info.Name() != "credential.json" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return err
+		}
+
+		note, err := ParseSecureNoteJson(data)
+		if err != nil {
+			return fmt.Errorf("%s: %s", fname, err)
+		}
+
+		creds = append(creds, &LocalCredential{Path: fname, Data: data, Note: note})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return creds, nil
+}
+
+type SyncUpOptions struct {
+	DryRun bool
+	Delete bool
+	Yes    bool
+}
+
+func (self *LPass) syncUpAdd(local *LocalCredential, opts SyncUpOptions) error {
+	err := ValidateSecureNote(local.Note)
+	if err != nil {
+		return err
+	}
+
+	cred, err := local.Note.GetStandardCredential()
+	if err != nil {
+		return err
+	}
+
+	name := local.Note.EntryName(cred)
+	fmt.Printf("+ add %s\n", name)
+	if opts.DryRun {
+		return nil
+	}
+
+	input, err := local.Note.ToLPassInput(cred)
+	if err != nil {
+		return err
+	}
+
+	id, err := self.backend().Add(name, local.Note.LPassType(), input)
+	if err != nil {
+		return err
+	}
+
+	// NB: record the new id locally so the next sync-up updates rather than adds again
+	local.Note.EntryInfo.AccountId = id
+	return local.Note.WriteJsonToFile(local.Path)
+}
+
+// syncUpUpdate returns true if the remote entry was changed
+func (self *LPass) syncUpUpdate(local *LocalCredential, opts SyncUpOptions) (bool, error) {
+	id := local.Note.EntryInfo.AccountId
+	current, err := self.GetSecureNote(id)
+	if err != nil {
+		return false, err
+	}
+
+	err = checkNotesAreJson(current, id)
+	if err != nil {
+		return false, err
+	}
+
+	merged, err := ReplaceSecureNote(current, local.Data)
+	if err != nil {
+		return false, err
+	}
+
+	// NB: only validate what's being pushed, an untouched legacy note is fine
+	changes := DiffSecureNotes(current, merged)
+	if len(changes) == 0 {
+		return false, nil
+	}
+
+	err = ValidateSecureNote(merged)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("~ update %s\n", current.EntryInfo.AccountNameIncludingPath)
+	for _, change := range changes {
+		fmt.Printf("    %s\n", change)
+	}
+
+	if opts.DryRun {
+		return true, nil
+	}
+
+	return true, self.applyChanges(id, merged, changes)
+}
+
+// SyncToRemote pushes the local CredentialsFolder up to lastpass: local
+// credentials without a (known) id are added, the rest are updated.
+// Remote entries with no local credential are only removed with --delete.
+func (self *LPass) SyncToRemote(args []string, opts SyncUpOptions) (*exec.Cmd, error) {
+	locals, err := self.ReadLocalCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	err = self.cacheInvalidate(listCacheKey)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := self.GetList(args)
+	if err != nil {
+		return nil, err
+	}
+
+	remote := make(map[string]*LPassEntry)
+	for _, entry := range entries {
+		remote[entry.AccountId] = entry
+	}
+
+	var errs []error
+	added, updated, unchanged, deleted := 0, 0, 0, 0
+	seen := make(map[string]bool)
+
+	for _, local := range locals {
+		id := local.Note.EntryInfo.AccountId
+		seen[id] = true
+
+		if _, ok := remote[id]; id == "" || !ok {
+			err = self.syncUpAdd(local, opts)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", local.Path, err))
+				continue
+			}
+			added++
+			continue
+		}
+
+		changed, err := self.syncUpUpdate(local, opts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", local.Path, err))
+			continue
+		}
+
+		if changed {
+			updated++
+		} else {
+			unchanged++
+		}
+	}
+
+	if opts.Delete {
+		orphans := make([]*LPassEntry, 0)
+		for _, entry := range entries {
+			if !seen[entry.AccountId] {
+				fmt.Printf("- delete %s\n", entry.AccountNameIncludingPath)
+				orphans = append(orphans, entry)
+			}
+		}
+
+		if opts.DryRun {
+			deleted = len(orphans)
+		} else if len(orphans) > 0 && (opts.Yes || self.confirm(fmt.Sprintf("Remove these %d entries from lastpass?", len(orphans)))) {
+			for _, entry := range orphans {
+				err = self.backend().Remove(entry.AccountId)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", entry.AccountNameIncludingPath, err))
+					continue
+				}
+				deleted++
+			}
+		}
+	}
+
+	if !opts.DryRun {
+		err = self.cacheInvalidate(listCacheKey)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	verb := "synced"
+	if opts.DryRun {
+		verb = "would sync"
+	}
+	fmt.Printf("sync-up %s: %d added, %d updated, %d deleted, %d unchanged, %d errors\n",
+		verb, added, updated, deleted, unchanged, len(errs))
+
+	return nil, errors.Join(errs...)
+}
+
+func (self *LPass) baseSnapshotPath(id string) string {
+	return filepath.Join(self.Cachedir, "base", id+".json")
+}
+
+// readBaseSnapshot returns nil if the entry has never been sync'd
+func (self *LPass) readBaseSnapshot(id string) (*LPassSecureNote, error) {
+	fname := self.baseSnapshotPath(id)
+	if id == "" || !FileExists(fname) {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, &CacheError{Op: "read", Key: "base/" + id, Path: fname, Err: err}
+	}
+
+	return ParseSecureNoteJson(data)
+}
+
+func (self *LPass) writeBaseSnapshot(note *LPassSecureNote) error {
+	fname := self.baseSnapshotPath(note.EntryInfo.AccountId)
+	err := note.WriteJsonToFile(fname)
+	if err != nil {
+		return &CacheError{Op: "write", Key: "base/" + note.EntryInfo.AccountId, Path: fname, Err: err}
+	}
+
+	return nil
+}
+
+func (self *LPass) removeBaseSnapshot(id string) error {
+	fname := self.baseSnapshotPath(id)
+	err := os.Remove(fname)
+	if err != nil && !os.IsNotExist(err) {
+		return &CacheError{Op: "remove", Key: "base/" + id, Path: fname, Err: err}
+	}
+
+	return nil
+}
+
+func conflictPath(credentialPath string) string {
+	return filepath.Join(filepath.Dir(credentialPath), "credential.conflict.json")
+}
+
+type ConflictReport struct {
+	Id        string
+	Path      string
+	Conflicts []*FieldConflict
+}
+
+func writeConflictReport(fname string, report *ConflictReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fname, data, 0600)
+}
+
+type SyncOptions struct {
+	DryRun bool
+	Delete bool
+}
+
+type syncStats struct {
+	Pushed, Pulled, Added, Deleted, Conflicts, Unchanged int
+}
+
+// syncBoth merges an entry that exists both locally and in lastpass
+func (self *LPass) syncBoth(remote *LPassSecureNote, local *LocalCredential, opts SyncOptions, stats *syncStats) error {
+	id := remote.EntryInfo.AccountId
+	name := remote.EntryInfo.AccountNameIncludingPath
+
+	cpath := conflictPath(local.Path)
+	if FileExists(cpath) {
+		fmt.Printf("! %s has an unresolved conflict, fix %s then remove %s\n", name, local.Path, cpath)
+		stats.Conflicts++
+		return nil
+	}
+
+	base, err := self.readBaseSnapshot(id)
+	if err != nil {
+		return err
+	}
+
+	ref := base
+	baseFields := map[string]string{}
+	if base == nil {
+		ref = remote
+	} else {
+		baseFields = base.Fields()
+	}
+
+	localNote, err := ReplaceSecureNote(ref, local.Data)
+	if err != nil {
+		return err
+	}
+
+	merged, conflicts := ThreeWayMerge(baseFields, localNote.Fields(), remote.Fields())
+
+	newRemote, err := remote.WithFields(merged)
+	if err != nil {
+		return err
+	}
+
+	// NB: conflicting fields keep their local values locally, and their remote values remotely
+	for _, conflict := range conflicts {
+		if conflict.Local == nil {
+			delete(merged, conflict.Field)
+		} else {
+			merged[conflict.Field] = *conflict.Local
+		}
+	}
+
+	newLocal, err := remote.WithFields(merged)
+	if err != nil {
+		return err
+	}
+
+	remoteChanges := DiffSecureNotes(remote, newRemote)
+	localChanges := DiffSecureNotes(localNote, newLocal)
+
+	if len(remoteChanges) > 0 {
+		err = checkNotesAreJson(remote, id)
+		if err != nil {
+			return err
+		}
+
+		err = ValidateSecureNote(newRemote)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("> push %s\n", name)
+		for _, change := range remoteChanges {
+			fmt.Printf("    %s\n", change)
+		}
+		stats.Pushed++
+	}
+
+	if len(localChanges) > 0 {
+		fmt.Printf("< pull %s\n", name)
+		for _, change := range localChanges {
+			fmt.Printf("    %s\n", change)
+		}
+		stats.Pulled++
+	}
+
+	if len(conflicts) > 0 {
+		fields := make([]string, 0)
+		for _, conflict := range conflicts {
+			fields = append(fields, conflict.Field)
+		}
+		fmt.Printf("! conflict %s: %q changed locally and in lastpass, see %s\n", name, fields, cpath)
+		stats.Conflicts++
+	}
+
+	if len(remoteChanges) == 0 && len(localChanges) == 0 && len(conflicts) == 0 {
+		stats.Unchanged++
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	if len(remoteChanges) > 0 {
+		err = self.applyChanges(id, newRemote, remoteChanges)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(localChanges) > 0 {
+		err = newLocal.WriteJsonToFile(local.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(conflicts) > 0 {
+		err = writeConflictReport(cpath, &ConflictReport{Id: id, Path: name, Conflicts: conflicts})
+		if err != nil {
+			return err
+		}
+	}
+
+	return self.writeBaseSnapshot(newRemote)
+}
+
+// syncRemoteOnly handles an entry that is in lastpass but not local: it's
+// either new in lastpass, or was deleted locally since the last sync
+func (self *LPass) syncRemoteOnly(remote *LPassSecureNote, opts SyncOptions, stats *syncStats) error {
+	id := remote.EntryInfo.AccountId
+	name := remote.EntryInfo.AccountNameIncludingPath
+
+	base, err := self.readBaseSnapshot(id)
+	if err != nil {
+		return err
+	}
+
+	if base == nil {
+		fname := remote.EntryInfo.ToPath(self.CredentialsFolder)
+		fmt.Printf("< pull %s\n", name)
+		stats.Pulled++
+		if opts.DryRun {
+			return nil
+		}
+
+		err = remote.WriteJsonToFile(fname)
+		if err != nil {
+			return err
+		}
+
+		return self.writeBaseSnapshot(remote)
+	}
+
+	if !opts.Delete {
+		fmt.Printf("? %s was deleted locally, use --delete to remove it from lastpass\n", name)
+		stats.Unchanged++
+		return nil
+	}
+
+	if len(DiffSecureNotes(base, remote)) > 0 {
+		fmt.Printf("! conflict %s: deleted locally but changed in lastpass\n", name)
+		stats.Conflicts++
+		return nil
+	}
+
+	fmt.Printf("- delete %s from lastpass\n", name)
+	stats.Deleted++
+	if opts.DryRun {
+		return nil
+	}
+
+	err = self.backend().Remove(id)
+	if err != nil {
+		return err
+	}
+
+	return self.removeBaseSnapshot(id)
+}
+
+// syncLocalOnly handles a local credential that isn't in lastpass: it's
+// either new locally (it has no id), or was deleted from lastpass since
+// the last sync or sync-down
+func (self *LPass) syncLocalOnly(local *LocalCredential, opts SyncOptions, stats *syncStats) error {
+	id := local.Note.EntryInfo.AccountId
+
+	base, err := self.readBaseSnapshot(id)
+	if err != nil {
+		return err
+	}
+
+	// NB: without a base there's no telling whether it changed locally, it
+	// mustn't be added back over a teammate's delete
+	if base == nil && id != "" {
+		fmt.Printf("! conflict %s: deleted from lastpass, remove it or clear its AccountId to add it again\n", local.Path)
+		stats.Conflicts++
+		return nil
+	}
+
+	if base == nil {
+		err = self.syncUpAdd(local, SyncUpOptions{DryRun: opts.DryRun})
+		if err != nil {
+			return err
+		}
+		stats.Added++
+		if opts.DryRun {
+			return nil
+		}
+
+		added, err := self.GetSecureNote(local.Note.EntryInfo.AccountId)
+		if err != nil {
+			return err
+		}
+
+		return self.writeBaseSnapshot(added)
+	}
+
+	localNote, err := ReplaceSecureNote(base, local.Data)
+	if err != nil {
+		return err
+	}
+
+	if len(DiffSecureNotes(base, localNote)) > 0 {
+		fmt.Printf("! conflict %s: changed locally but deleted from lastpass\n", local.Path)
+		stats.Conflicts++
+		return nil
+	}
+
+	fmt.Printf("- delete %s\n", local.Path)
+	stats.Deleted++
+	if opts.DryRun {
+		return nil
+	}
+
+	err = self.removeLocalFile(local.Path)
+	if err != nil {
+		return err
+	}
+
+	return self.removeBaseSnapshot(id)
+}
+
+// Sync is a two way sync between lastpass and the CredentialsFolder.  Each
+// entry is three-way merged against a snapshot of its state after the
+// last sync (kept under the Cachedir), conflicting changes are reported
+// and written to a credential.conflict.json next to the credential.
+func (self *LPass) Sync(args []string, opts SyncOptions) (*exec.Cmd, error) {
+	locals := make([]*LocalCredential, 0)
+	if DirExists(self.CredentialsFolder) {
+		var err error
+		locals, err = self.ReadLocalCredentials()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := self.cacheInvalidate(listCacheKey)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := self.GetList(args)
+	if err != nil {
+		return nil, err
+	}
+
+	localsById := make(map[string]*LocalCredential)
+	for _, local := range locals {
+		if id := local.Note.EntryInfo.AccountId; id != "" {
+			localsById[id] = local
+		}
+	}
+
+	var errs []error
+	stats := &syncStats{}
+	seen := make(map[string]bool)
+
+	for _, entry := range entries {
+		seen[entry.AccountId] = true
+
+		remote, err := self.GetSecureNote(entry.AccountId)
+		if err == nil {
+			if local, ok := localsById[entry.AccountId]; ok {
+				err = self.syncBoth(remote, local, opts, stats)
+			} else {
+				err = self.syncRemoteOnly(remote, opts, stats)
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.AccountNameIncludingPath, err))
+		}
+	}
+
+	for _, local := range locals {
+		if seen[local.Note.EntryInfo.AccountId] {
+			continue
+		}
+
+		err = self.syncLocalOnly(local, opts, stats)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", local.Path, err))
+		}
+	}
+
+	if !opts.DryRun {
+		err = self.cacheInvalidate(listCacheKey)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	fmt.Printf("sync: %d pushed, %d pulled, %d added, %d deleted, %d conflicts, %d unchanged, %d errors\n",
+		stats.Pushed, stats.Pulled, stats.Added, stats.Deleted, stats.Conflicts, stats.Unchanged, len(errs))
+
+	if stats.Conflicts > 0 {
+		errs = append(errs, fmt.Errorf("%d entries have conflicts that need to be resolved by hand", stats.Conflicts))
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// FetchSecureNotes shows each of the entries using up to parallel workers,
+// the results (and errors) are in the same order as the entries
+func (self *LPass) FetchSecureNotes(entries []*LPassEntry, parallel int) ([]*LPassSecureNote, []error) {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	notes := make([]*LPassSecureNote, len(entries))
+	errs := make([]error, len(entries))
+
+	jobs := make(chan int)
+	var done int64
+	var wg sync.WaitGroup
+
+	for ww := 0; ww < parallel && ww < len(entries); ww++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ii := range jobs {
+				notes[ii], errs[ii] = self.GetSecureNote(entries[ii].AccountId)
+				fmt.Fprintf(os.Stderr, "\rfetched %d/%d", atomic.AddInt64(&done, 1), len(entries))
+			}
+		}()
+	}
+
+	for ii := range entries {
+		jobs <- ii
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(entries) > 0 {
+		fmt.Fprintf(os.Stderr, "\n")
+	}
+
+	return notes, errs
+}
+
+type SyncDownManifestEntry struct {
+	ModificationTime string
+	Path             string
+}
+
+// SyncDownManifest records the modification time of every entry as of the
+// last sync-down, and where it was written, keyed by id
+type SyncDownManifest map[string]*SyncDownManifestEntry
+
+func (self SyncDownManifest) Ids() []string {
+	ids := make([]string, 0, len(self))
+	for id := range self {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (self *LPass) readSyncDownManifest() (SyncDownManifest, error) {
+	manifest := make(SyncDownManifest)
+
+	data, found, err := self.cacheGet("SyncDown.manifest.json")
+	if err != nil || !found {
+		return manifest, err
+	}
+
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, &CacheError{Op: "read", Key: "SyncDown.manifest.json", Path: filepath.Join(self.Cachedir, "SyncDown.manifest.json"), Err: err}
+	}
+
+	return manifest, nil
+}
+
+func (self *LPass) writeSyncDownManifest(manifest SyncDownManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return self.cachePut("SyncDown.manifest.json", string(data))
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// syncedFakeLPass is a fake vault that has been sync'd down, the tivo.com
+// entry's Notes aren't a StandardCredential
+func syncedFakeLPass(t *testing.T) (*LPass, *FakeBackend) {
+	lpass, fake := newFakeLPass(t, "basic")
+
+	captureStdout(t, func() {
+		_, err := lpass.SyncToLocal([]string{}, SyncDownOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	return lpass, fake
+}
+
+func rewriteLocalCredential(t *testing.T, fname, old, new string) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), old) {
+		t.Fatalf("Error: expected %s to contain '%s', got:\n%s", fname, old, data)
+	}
+
+	err = ioutil.WriteFile(fname, []byte(strings.Replace(string(data), old, new, 1)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncUpNoChanges(t *testing.T) {
+	lpass, fake := syncedFakeLPass(t)
+
+	output := captureStdout(t, func() {
+		_, err := lpass.SyncToRemote([]string{}, SyncUpOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if !strings.Contains(output, "0 added, 0 updated, 0 deleted, 3 unchanged") || len(fake.Mutations) != 0 {
+		t.Errorf("Error: expected no changes, got %+v\n%s", fake.Mutations, output)
+	}
+}
+
+func TestSyncUpUntouchedLegacyNote(t *testing.T) {
+	lpass, fake := syncedFakeLPass(t)
+
+	tivo := filepath.Join(lpass.CredentialsFolder, "-none-", "tivo.com", "credential.json")
+	if !FileExists(tivo) {
+		t.Fatalf("Error: expected sync-down to write %s", tivo)
+	}
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.SyncToRemote([]string{}, SyncUpOptions{})
+	})
+
+	if err != nil || !strings.Contains(output, "0 errors") || len(fake.Mutations) != 0 {
+		t.Errorf("Error: expected an untouched legacy note not to be validated, got %v / %+v\n%s", err, fake.Mutations, output)
+	}
+}
+
+func TestSyncUpAddsAndUpdates(t *testing.T) {
+	lpass, fake := syncedFakeLPass(t)
+
+	rewriteLocalCredential(t,
+		filepath.Join(lpass.CredentialsFolder, "Shared-Infra", "aws", "deploy-key", "credential.json"),
+		`"Owner": "infra"`, `"Owner": "platform"`)
+
+	newCred := filepath.Join(lpass.CredentialsFolder, "Shared-Infra", "db", "reporting", "credential.json")
+	err := os.MkdirAll(filepath.Dir(newCred), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(newCred, []byte(addNoteJson), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureStdout(t, func() {
+		_, err = lpass.SyncToRemote([]string{}, SyncUpOptions{DryRun: true})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"+ add Shared-Infra/db/reporting",
+		"~ update Shared-Infra/aws/deploy-key",
+		`~ Notes.Owner: "infra" -> "platform"`,
+		"would sync: 1 added, 1 updated, 0 deleted, 2 unchanged",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Error: expected the dry run to contain '%s', got:\n%s", expected, output)
+		}
+	}
+
+	if len(fake.Mutations) != 0 {
+		t.Fatalf("Error: expected a dry run not to change lastpass, got %+v", fake.Mutations)
+	}
+
+	captureStdout(t, func() {
+		_, err = lpass.SyncToRemote([]string{}, SyncUpOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(fake.Find("deploy-key").Get("Notes"), `"Owner": "platform"`) {
+		t.Errorf("Error: expected deploy-key to be updated, got %s", fake.Find("deploy-key").Get("Notes"))
+	}
+
+	added := fake.Find("Shared-Infra/db/reporting")
+	if added == nil {
+		t.Fatalf("Error: expected Shared-Infra/db/reporting to be added, got %+v", fake.Mutations)
+	}
+
+	data, _ := ioutil.ReadFile(newCred)
+	if !strings.Contains(string(data), added.Id) {
+		t.Errorf("Error: expected the new id %s to be saved to %s", added.Id, newCred)
+	}
+
+	// NB: a second sync-up must not add the new credential again
+	mutations := len(fake.Mutations)
+	captureStdout(t, func() {
+		_, err = lpass.SyncToRemote([]string{}, SyncUpOptions{})
+	})
+	if err != nil || len(fake.Mutations) != mutations {
+		t.Errorf("Error: expected the second sync-up to do nothing, got %v / %+v", err, fake.Mutations[mutations:])
+	}
+}
+
+func TestSyncUpDelete(t *testing.T) {
+	lpass, fake := syncedFakeLPass(t)
+
+	err := os.RemoveAll(filepath.Join(lpass.CredentialsFolder, "-none-"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureStdout(t, func() {
+		_, err := lpass.SyncToRemote([]string{}, SyncUpOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if fake.Find("tivo.com") == nil || strings.Contains(output, "- delete") {
+		t.Fatalf("Error: expected sync-up not to delete without --delete, got:\n%s", output)
+	}
+
+	output = captureStdout(t, func() {
+		_, err := lpass.SyncToRemote([]string{}, SyncUpOptions{Delete: true, Yes: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if fake.Find("tivo.com") != nil || !strings.Contains(output, "- delete (none)/tivo.com") {
+		t.Errorf("Error: expected tivo.com to be deleted, got:\n%s", output)
+	}
+}
+
+func TestSyncUpReportsInvalidCredentials(t *testing.T) {
+	lpass, fake := syncedFakeLPass(t)
+
+	rewriteLocalCredential(t,
+		filepath.Join(lpass.CredentialsFolder, "Shared-Infra", "aws", "deploy-key", "credential.json"),
+		`"Owner": "infra"`, `"Colour": "blue"`)
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.SyncToRemote([]string{}, SyncUpOptions{})
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "Colour") {
+		t.Errorf("Error: expected sync-up to report the invalid credential, got %v", err)
+	}
+
+	if !strings.Contains(output, "1 errors") || len(fake.Mutations) != 0 {
+		t.Errorf("Error: expected 1 error and no changes, got %+v\n%s", fake.Mutations, output)
+	}
+}
+
+func TestSyncPushesAndPulls(t *testing.T) {
+	lpass, fake := syncedFakeLPass(t)
+
+	captureStdout(t, func() {
+		_, err := lpass.Sync([]string{}, SyncOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	local := filepath.Join(lpass.CredentialsFolder, "Shared-Infra", "aws", "deploy-key", "credential.json")
+	rewriteLocalCredential(t, local, `"Owner": "infra"`, `"Owner": "platform"`)
+
+	remote := fake.Find("deploy-key")
+	remote.Set("Notes", strings.Replace(remote.Get("Notes"), `"Usage": "`, `"Usage": "CHANGED `, 1))
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Sync([]string{}, SyncOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"> push Shared-Infra/aws/deploy-key",
+		`~ Notes.Owner: "infra" -> "platform"`,
+		"< pull Shared-Infra/aws/deploy-key",
+		"sync: 1 pushed, 1 pulled, 0 added, 0 deleted, 0 conflicts",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Error: expected sync to contain '%s', got:\n%s", expected, output)
+		}
+	}
+
+	if !strings.Contains(fake.Find("deploy-key").Get("Notes"), `"Owner": "platform"`) {
+		t.Errorf("Error: expected the local Owner to be pushed, got %s", fake.Find("deploy-key").Get("Notes"))
+	}
+
+	data, _ := ioutil.ReadFile(local)
+	if !strings.Contains(string(data), `"Usage": "CHANGED `) || !strings.Contains(string(data), `"Owner": "platform"`) {
+		t.Errorf("Error: expected the remote Usage to be pulled, got:\n%s", data)
+	}
+
+	mutations := len(fake.Mutations)
+	output = captureStdout(t, func() {
+		_, err = lpass.Sync([]string{}, SyncOptions{})
+	})
+	if err != nil || len(fake.Mutations) != mutations || !strings.Contains(output, "3 unchanged") {
+		t.Errorf("Error: expected the second sync to do nothing, got %v / %+v\n%s", err, fake.Mutations[mutations:], output)
+	}
+}
+
+func TestSyncConflict(t *testing.T) {
+	lpass, fake := syncedFakeLPass(t)
+
+	captureStdout(t, func() {
+		lpass.Sync([]string{}, SyncOptions{})
+	})
+
+	local := filepath.Join(lpass.CredentialsFolder, "Shared-Infra", "aws", "deploy-key", "credential.json")
+	conflict := filepath.Join(filepath.Dir(local), "credential.conflict.json")
+	rewriteLocalCredential(t, local, `"Owner": "infra"`, `"Owner": "platform"`)
+
+	remote := fake.Find("deploy-key")
+	remote.Set("Notes", strings.Replace(remote.Get("Notes"), `"Owner": "infra"`, `"Owner": "security"`, 1))
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Sync([]string{}, SyncOptions{})
+	})
+
+	if err == nil || !strings.Contains(output, `! conflict Shared-Infra/aws/deploy-key: ["Notes.Owner"]`) {
+		t.Fatalf("Error: expected a conflict on Notes.Owner, got %v:\n%s", err, output)
+	}
+
+	report, _ := ioutil.ReadFile(conflict)
+	if !strings.Contains(string(report), `"Local": "\"platform\""`) || !strings.Contains(string(report), `"Remote": "\"security\""`) {
+		t.Errorf("Error: expected the conflict report to have both values, got:\n%s", report)
+	}
+
+	if !strings.Contains(fake.Find("deploy-key").Get("Notes"), `"Owner": "security"`) {
+		t.Errorf("Error: expected the conflicting field not to be pushed")
+	}
+
+	mutations := len(fake.Mutations)
+	output = captureStdout(t, func() {
+		_, err = lpass.Sync([]string{}, SyncOptions{})
+	})
+	if err == nil || !strings.Contains(output, "unresolved conflict") || len(fake.Mutations) != mutations {
+		t.Errorf("Error: expected the entry to be skipped until resolved, got %v:\n%s", err, output)
+	}
+
+	// resolve in favour of the local value by removing the conflict file
+	err = os.Remove(conflict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	captureStdout(t, func() {
+		_, err = lpass.Sync([]string{}, SyncOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(fake.Find("deploy-key").Get("Notes"), `"Owner": "platform"`) {
+		t.Errorf("Error: expected the resolved value to be pushed, got %s", fake.Find("deploy-key").Get("Notes"))
+	}
+}
+
+func TestSyncDeletes(t *testing.T) {
+	lpass, fake := syncedFakeLPass(t)
+
+	captureStdout(t, func() {
+		lpass.Sync([]string{}, SyncOptions{})
+	})
+
+	tivo := filepath.Join(lpass.CredentialsFolder, "-none-", "tivo.com", "credential.json")
+	err := os.Remove(tivo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = fake.Remove("deploy-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureStdout(t, func() {
+		_, err = lpass.Sync([]string{}, SyncOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fake.Find("tivo.com") == nil || !strings.Contains(output, "use --delete") {
+		t.Errorf("Error: expected the local delete not to be pushed without --delete, got:\n%s", output)
+	}
+
+	if FileExists(filepath.Join(lpass.CredentialsFolder, "Shared-Infra")) {
+		t.Errorf("Error: expected the remote delete to remove the local credential")
+	}
+
+	captureStdout(t, func() {
+		_, err = lpass.Sync([]string{}, SyncOptions{Delete: true})
+	})
+	if err != nil || fake.Find("tivo.com") != nil {
+		t.Errorf("Error: expected --delete to remove tivo.com, got %v", err)
+	}
+}
+
+func TestSyncAfterSyncDownKeepsRemoteDeletes(t *testing.T) {
+	lpass, fake := syncedFakeLPass(t)
+
+	for _, name := range []string{"deploy-key", "tivo.com"} {
+		err := fake.Remove(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// NB: a credential without a base can't be told apart from a local change
+	err := os.Remove(lpass.baseSnapshotPath("5926414273882541009"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureStdout(t, func() {
+		_, err = lpass.Sync([]string{}, SyncOptions{})
+	})
+
+	if err == nil || !strings.Contains(output, "! conflict "+filepath.Join(lpass.CredentialsFolder, "-none-", "tivo.com", "credential.json")+": deleted from lastpass") {
+		t.Errorf("Error: expected tivo.com to be reported, got %v:\n%s", err, output)
+	}
+
+	if strings.Contains(output, "+ add") || fake.Find("deploy-key") != nil || fake.Find("tivo.com") != nil {
+		t.Errorf("Error: expected nothing to be added back to lastpass, got:\n%s", output)
+	}
+
+	if FileExists(filepath.Join(lpass.CredentialsFolder, "Shared-Infra")) {
+		t.Errorf("Error: expected the remote delete of deploy-key to remove the local credential, got:\n%s", output)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+	// summarized is set when Old and New have been replaced with something
+	// that's safe to print, eg: "(3 lines of text)"
+	summarized bool
+}
+
+func (self *FieldChange) IsNotes() bool {
+	return self.Field == "Notes" || strings.HasPrefix(self.Field, "Notes.")
+}
+
+// publicFields are the only fields whose values are printed, or searched,
+// without --show-secrets.  Anything else could be a secret (an API Token
+// property, an apikey in the Notes, ...).  The elements of a public list
+// are public too (Notes.Tags.0).
+var publicFields = []string{
+	"Id",
+	"Name",
+	"URL",
+	"NoteType",
+	"Notes.Name",
+	"Notes.Owner",
+	"Notes.Description",
+	"Notes.IssuedAt",
+	"Notes.IssuedBy",
+	"Notes.IssuedTo",
+	"Notes.ExpiresAt",
+	"Notes.LastRotatedAt",
+	"Notes.Usage",
+	"Notes.Help",
+	"Notes.ProjectUrl",
+	"Notes.Url",
+	"Notes.Tags",
+}
+
+func isPublicField(name string) bool {
+	for _, field := range publicFields {
+		if strings.EqualFold(name, field) {
+			return true
+		}
+		if len(name) > len(field) && strings.EqualFold(name[:len(field)+1], field+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+var secretFieldNames = []string{"password", "passphrase", "private key", "secret", "credential", "pin"}
+
+// isSecretField is true for the fields known to hold secrets, migrate
+// keeps those in the Properties.  NB: a field that isn't secret still
+// isn't printed unless it's public, see isPublicField.
+func isSecretField(name string) bool {
+	if noteTypeSecretFields[name] {
+		return true
+	}
+
+	name = strings.ToLower(strings.TrimPrefix(name, "Notes."))
+	for _, secret := range secretFieldNames {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (self *FieldChange) String() string {
+	old, new := self.Old, self.New
+	if !self.summarized && !isPublicField(self.Field) {
+		old, new = "********", "********"
+	}
+
+	switch {
+	case self.Old == "":
+		return fmt.Sprintf("+ %s: %s", self.Field, new)
+	case self.New == "":
+		return fmt.Sprintf("- %s: %s", self.Field, old)
+	}
+
+	return fmt.Sprintf("~ %s: %s -> %s", self.Field, old, new)
+}
+
+func (self *LPassSecureNote) Copy() (*LPassSecureNote, error) {
+	return ParseSecureNoteJson(self.ToJson())
+}
+
+// Fields flattens the note into the individually editable fields: the
+// entry Name, each property and each top level key of the Notes json
+func (self *LPassSecureNote) Fields() map[string]string {
+	fields := make(map[string]string)
+
+	if self.EntryInfo != nil && self.EntryInfo.AccountNameIncludingPath != "" {
+		fields["Name"] = strings.TrimPrefix(self.EntryInfo.AccountNameIncludingPath, "(none)/")
+	}
+
+	for k, v := range self.Properties {
+		fields[k] = v
+	}
+
+	if notes, ok := self.Notes.(map[string]interface{}); ok {
+		for k, v := range notes {
+			b, _ := json.Marshal(v)
+			fields["Notes."+k] = string(b)
+		}
+	} else if self.Notes != nil {
+		b, _ := json.Marshal(self.Notes)
+		fields["Notes"] = string(b)
+	}
+
+	return fields
+}
+
+func DiffSecureNotes(old, new *LPassSecureNote) []*FieldChange {
+	oldFields, newFields := old.Fields(), new.Fields()
+	changes := make([]*FieldChange, 0)
+
+	for k, v := range newFields {
+		if oldFields[k] != v {
+			changes = append(changes, &FieldChange{Field: k, Old: oldFields[k], New: v})
+		}
+	}
+
+	for k, v := range oldFields {
+		if _, ok := newFields[k]; !ok {
+			changes = append(changes, &FieldChange{Field: k, Old: v})
+		}
+	}
+
+	sort.Slice(changes, func(ii, jj int) bool {
+		return changes[ii].Field < changes[jj].Field
+	})
+
+	return changes
+}
+
+// MergeSecureNotePatch applies a full or partial LPassSecureNote json
+// document to a copy of the current note.  Properties and Credential
+// values overwrite the current ones, Notes keys are merged into the
+// current Notes (a null value removes the key).
+func MergeSecureNotePatch(current *LPassSecureNote, patch []byte) (*LPassSecureNote, error) {
+	merged, err := current.Copy()
+	if err != nil {
+		return nil, err
+	}
+
+	var parts map[string]json.RawMessage
+	err = json.Unmarshal(patch, &parts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secure note json: %s", err)
+	}
+
+	if raw, ok := parts["EntryInfo"]; ok {
+		ent := &LPassEntry{}
+		err = json.Unmarshal(raw, ent)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EntryInfo: %s", err)
+		}
+		if ent.AccountNameIncludingPath != "" {
+			merged.EntryInfo.AccountNameIncludingPath = ent.AccountNameIncludingPath
+		}
+	}
+
+	if raw, ok := parts["Properties"]; ok {
+		var props map[string]string
+		err = json.Unmarshal(raw, &props)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Properties: %s", err)
+		}
+		for k, v := range props {
+			if !strings.HasPrefix(k, "_") {
+				merged.Properties[k] = v
+			}
+		}
+	}
+
+	// NB: a full document has Username, Password and URL in both Credential
+	// and Properties, whichever was changed from the current note wins.  The
+	// Credential can also hold values from the Notes, those aren't changes.
+	if raw, ok := parts["Credential"]; ok {
+		cred := &StandardCredential{}
+		err = json.Unmarshal(raw, cred)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Credential: %s", err)
+		}
+		for field, name := range credentialProperties {
+			val := reflect.ValueOf(cred).Elem().FieldByName(field).String()
+			was := reflect.ValueOf(current.Credential).Elem().FieldByName(field).String()
+			if val != "" && val != current.Properties[name] && val != was {
+				merged.Properties[name] = val
+			}
+		}
+	}
+
+	if raw, ok := parts["Notes"]; ok {
+		var notes map[string]interface{}
+		err = json.Unmarshal(raw, &notes)
+		if err != nil {
+			return nil, fmt.Errorf("expected Notes to be a json object: %s", err)
+		}
+
+		current, ok := merged.Notes.(map[string]interface{})
+		if !ok || current == nil {
+			current = make(map[string]interface{})
+		}
+
+		for k, v := range notes {
+			switch {
+			case strings.HasPrefix(k, "_"):
+				continue
+			case v == nil:
+				delete(current, k)
+			default:
+				current[k] = v
+			}
+		}
+		merged.Notes = current
+	}
+
+	merged.rebuildViews()
+
+	return merged, nil
+}
+
+func checkNotesAreJson(note *LPassSecureNote, id_or_name string) error {
+	if note.RawNotes != "" && !json.Valid([]byte(note.RawNotes)) {
+		return fmt.Errorf("the Notes for %s are not json, refusing to overwrite them", id_or_name)
+	}
+
+	return nil
+}
+
+// ValidateSecureNote checks the Notes match the StandardCredential schema
+func ValidateSecureNote(note *LPassSecureNote) error {
+	violations := ValidateNotes(note)
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+
+	return nil
+}
+
+// applyChanges writes each changed field back to lastpass, the Notes are
+// written once as a whole json document no matter how many keys changed
+func (self *LPass) applyChanges(id string, note *LPassSecureNote, changes []*FieldChange) error {
+	notesChanged := false
+
+	for _, change := range changes {
+		if change.IsNotes() {
+			notesChanged = true
+			continue
+		}
+
+		err := self.backend().Edit(id, change.Field, change.New)
+		if err != nil {
+			return err
+		}
+	}
+
+	if notesChanged {
+		notes, err := json.MarshalIndent(note.Notes, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		err = self.backend().Edit(id, "Notes", string(notes))
+		if err != nil {
+			return err
+		}
+	}
+
+	return self.cacheInvalidate(listCacheKey)
+}
+
+func printChanges(changes []*FieldChange) {
+	for _, change := range changes {
+		fmt.Printf("%s\n", change)
+	}
+}
+
+type UpdateOptions struct {
+	DryRun bool
+}
+
+func (self *LPass) Update(args []string, opts UpdateOptions) (*exec.Cmd, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("Error: you must supply a ID or name")
+	}
+
+	patch, err := self.readJsonInput(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := self.GetSecureNote(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkNotesAreJson(current, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := MergeSecureNotePatch(current, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ValidateSecureNote(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := DiffSecureNotes(current, merged)
+	if len(changes) == 0 {
+		fmt.Printf("No changes.\n")
+		return nil, nil
+	}
+
+	printChanges(changes)
+
+	if opts.DryRun {
+		return nil, nil
+	}
+
+	err = self.applyChanges(current.EntryInfo.AccountId, merged, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
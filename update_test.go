@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestUpdatePartialNotes(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	lpass.Stdin = strings.NewReader(`{"Notes": {"Owner": "infra", "Usage": "dashboards"}, "Credential": {"Password": "n3w"}}`)
+
+	var err error
+	output := captureStdout(t, func() {
+		_, err = lpass.Update([]string{"Test Note for Notes"}, UpdateOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`~ Notes.Owner: "platform" -> "infra"`,
+		`+ Notes.Usage: "dashboards"`,
+		`+ Password: ********`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Error: expected the diff to contain '%s', got:\n%s", expected, output)
+		}
+	}
+
+	ent := fake.Find("4281390154665116890")
+	var notes map[string]string
+	err = json.Unmarshal([]byte(ent.Get("Notes")), &notes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if notes["Owner"] != "infra" || notes["Usage"] != "dashboards" || notes["Name"] != "Test Note for Notes" {
+		t.Errorf("Error: expected the Notes to be merged, got %+v", notes)
+	}
+
+	if ent.Get("Password") != "n3w" {
+		t.Errorf("Error: expected Password to be updated, got '%s'", ent.Get("Password"))
+	}
+
+	edits := 0
+	for _, mutation := range fake.Mutations {
+		if mutation.Op == "edit" {
+			edits++
+		}
+	}
+
+	// NB: one for the Password, one for the whole Notes blob
+	if edits != 2 {
+		t.Errorf("Error: expected 2 edits, got %+v", fake.Mutations)
+	}
+}
+
+func TestUpdateRemovesNotesKey(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	lpass.Stdin = strings.NewReader(`{"Notes": {"Usage": null}}`)
+
+	captureStdout(t, func() {
+		_, err := lpass.Update([]string{"deploy-key"}, UpdateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if strings.Contains(fake.Find("deploy-key").Get("Notes"), "Usage") {
+		t.Errorf("Error: expected Usage to be removed from the Notes, got %s", fake.Find("deploy-key").Get("Notes"))
+	}
+}
+
+func TestUpdateDryRun(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	lpass.Stdin = strings.NewReader(`{"Notes": {"Owner": "someone-else"}}`)
+
+	output := captureStdout(t, func() {
+		_, err := lpass.Update([]string{"deploy-key"}, UpdateOptions{DryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if !strings.Contains(output, "Notes.Owner") || len(fake.Mutations) != 0 {
+		t.Errorf("Error: expected a diff and no mutations, got %+v\n%s", fake.Mutations, output)
+	}
+}
+
+func TestUpdateRejectsInvalidResult(t *testing.T) {
+	cases := map[string]string{
+		"unknown notes key": `{"Notes": {"Colour": "blue"}}`,
+		"removed name":      `{"Notes": {"Name": null}}`,
+	}
+
+	for label, patch := range cases {
+		lpass, fake := newFakeLPass(t, "basic")
+		lpass.Stdin = strings.NewReader(patch)
+
+		_, err := lpass.Update([]string{"deploy-key"}, UpdateOptions{})
+		if err == nil || len(fake.Mutations) != 0 {
+			t.Errorf("Error: expected update to reject %s without changes, got %v / %+v", label, err, fake.Mutations)
+		}
+	}
+}
+
+func TestUpdateRefusesNonJsonNotes(t *testing.T) {
+	lpass, fake := newFakeLPass(t, "basic")
+	fake.Find("tivo.com").Set("Notes", "remember to renew in june")
+	lpass.Stdin = strings.NewReader(`{"Notes": {"Name": "tivo"}}`)
+
+	_, err := lpass.Update([]string{"tivo.com"}, UpdateOptions{})
+	if err == nil {
+		t.Error("Error: expected update to refuse to overwrite free text Notes")
+	}
+}
+
+func TestFieldChangeOnlyShowsPublicFields(t *testing.T) {
+	for _, tc := range []struct {
+		change   *FieldChange
+		expected string
+	}{
+		{&FieldChange{Field: "Notes.Owner", Old: `"infra"`, New: `"platform"`}, `~ Notes.Owner: "infra" -> "platform"`},
+		{&FieldChange{Field: "Notes.Tags", New: `["api"]`}, `+ Notes.Tags: ["api"]`},
+		{&FieldChange{Field: "API Token", Old: "ghp_old", New: "ghp_new"}, "~ API Token: ******** -> ********"},
+		{&FieldChange{Field: "Notes.apikey", Old: `"sk_live_abc"`}, "- Notes.apikey: ********"},
+	} {
+		if got := tc.change.String(); got != tc.expected {
+			t.Errorf("Error: expected '%s', got '%s'", tc.expected, got)
+		}
+	}
+}